@@ -0,0 +1,200 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package shout
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"os/user"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// AUDIT_FILE is the file where StartLogger opens the audit log, which records
+// every command run, file edited and package operation, as JSON lines. The
+// audit log is not written if it is empty.
+var AUDIT_FILE string
+
+// _AUDIT_HASH_LEN is the length of the hashes of outputs in the audit log.
+const _AUDIT_HASH_LEN = 16
+
+var (
+	auditMu   sync.Mutex
+	auditOut  io.Writer // nil if the audit is disabled
+	auditFile *os.File
+	auditUser string
+)
+
+// auditRecord represents an entry in the audit log.
+type auditRecord struct {
+	Time time.Time `json:"time"`
+	User string    `json:"user"`
+	Kind string    `json:"kind"` // "run", "file" or "package"
+
+	// == Run
+	Command  string     `json:"command,omitempty"`
+	Argv     [][]string `json:"argv,omitempty"` // for every command of the pipeline
+	Dir      string     `json:"cwd,omitempty"`
+	Duration *float64   `json:"duration,omitempty"` // in seconds
+	ExitCode *int       `json:"exit_code,omitempty"`
+	Output   string     `json:"output_sha256,omitempty"`
+	Stderr   string     `json:"stderr_sha256,omitempty"`
+
+	// == File
+	Path   string `json:"path,omitempty"`
+	Backup string `json:"backup,omitempty"`
+	Before string `json:"before_sha256,omitempty"`
+	After  string `json:"after_sha256,omitempty"`
+
+	// == Package
+	Manager  string   `json:"manager,omitempty"`
+	Packages []string `json:"packages,omitempty"`
+
+	Operation string `json:"operation,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// startAudit opens the audit log.
+func startAudit() error {
+	if AUDIT_FILE == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(AUDIT_FILE, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+
+	auditMu.Lock()
+	auditFile, auditOut = f, f
+	auditMu.Unlock()
+	return nil
+}
+
+// closeAudit closes the audit log.
+func closeAudit() error {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	if auditFile == nil {
+		return nil
+	}
+	err := auditFile.Close()
+	auditFile, auditOut = nil, nil
+	return err
+}
+
+// Auditing reports whether the audit log is enabled, so the data to record can
+// be got only when it is needed.
+func Auditing() bool {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	return auditOut != nil
+}
+
+// writeAudit writes the record in the audit log, if it is enabled.
+func writeAudit(r *auditRecord) {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	if auditOut == nil {
+		return
+	}
+
+	if auditUser == "" {
+		if u, err := user.Current(); err == nil {
+			auditUser = u.Username
+		} else {
+			auditUser = strconv.Itoa(os.Getuid())
+		}
+	}
+	r.Time, r.User = time.Now(), auditUser
+
+	// Mask the secrets
+	r.Command, r.Error = Redact(r.Command), Redact(r.Error)
+	for _, args := range r.Argv {
+		for i, v := range args {
+			args[i] = Redact(v)
+		}
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		Log.Error("audit record not written", "error", err)
+		return
+	}
+	if _, err = auditOut.Write(append(b, '\n')); err != nil {
+		Log.Error("audit record not written", "error", err)
+	}
+}
+
+// auditRun records a command line run.
+func auditRun(line string, argv [][]string, d time.Duration, exitCode int, stdout, stderr []byte, err error) {
+	dir, _ := os.Getwd()
+	seconds := d.Seconds()
+
+	r := &auditRecord{
+		Kind:     "run",
+		Command:  line,
+		Argv:     argv,
+		Dir:      dir,
+		Duration: &seconds,
+		ExitCode: &exitCode,
+		Output:   hashOutput(stdout),
+		Stderr:   hashOutput(stderr),
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	writeAudit(r)
+}
+
+// hashOutput returns the SHA-256 of b truncated to _AUDIT_HASH_LEN characters,
+// or an empty string if b is empty.
+func hashOutput(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])[:_AUDIT_HASH_LEN]
+}
+
+// AuditEdit records the change of the named file by operation, with the name of
+// the backup, and the SHA-256 checksums of the file before and after of the
+// change. The checksum is empty for a file that did not exist.
+func AuditEdit(name, operation, backup, before, after string, err error) {
+	r := &auditRecord{
+		Kind:      "file",
+		Path:      name,
+		Operation: operation,
+		Backup:    backup,
+		Before:    before,
+		After:     after,
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	writeAudit(r)
+}
+
+// AuditPackages records an operation on packages made by a package manager.
+func AuditPackages(manager, operation string, packages []string, err error) {
+	r := &auditRecord{
+		Kind:      "package",
+		Manager:   manager,
+		Operation: operation,
+		Packages:  packages,
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	writeAudit(r)
+}
@@ -0,0 +1,81 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package shout
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAudit(t *testing.T) {
+	AUDIT_FILE = filepath.Join(os.TempDir(), "test-shout-audit.json")
+	defer func() { AUDIT_FILE = "" }()
+	defer os.Remove(AUDIT_FILE)
+
+	if err := startAudit(); err != nil {
+		t.Fatal(err)
+	}
+	if !Auditing() {
+		t.Fatal("Auditing got false")
+	}
+
+	Run("echo foo | cat")
+	Run("sh -c 'exit 3'")
+	AuditEdit("/etc/foo", "Replace", "/etc/foo+1~", "aa", "bb", nil)
+	AuditPackages("deb", "install", []string{"curl"}, nil)
+
+	if err := closeAudit(); err != nil {
+		t.Fatal(err)
+	}
+	if Auditing() {
+		t.Fatal("Auditing got true after of closing")
+	}
+
+	f, err := os.Open(AUDIT_FILE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var records []auditRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r auditRecord
+		if err = json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatal(err)
+		}
+		if r.User == "" || r.Time.IsZero() {
+			t.Errorf("record without user or time: %s", scanner.Bytes())
+		}
+		records = append(records, r)
+	}
+
+	if len(records) != 4 {
+		t.Fatalf("got %d records, want 4", len(records))
+	}
+
+	r := records[0]
+	if r.Kind != "run" || len(r.Argv) != 2 || r.Argv[0][1] != "foo" ||
+		*r.ExitCode != 0 || r.Output != hashOutput([]byte("foo\n")) || r.Dir == "" {
+		t.Errorf("record of run got %+v", r)
+	}
+	if len(r.Output) != _AUDIT_HASH_LEN {
+		t.Errorf("hash of output got %d characters, want %d", len(r.Output), _AUDIT_HASH_LEN)
+	}
+	if r = records[1]; *r.ExitCode != 3 {
+		t.Errorf("exit code got %d, want 3", *r.ExitCode)
+	}
+	if r = records[2]; r.Kind != "file" || r.Backup != "/etc/foo+1~" || r.After != "bb" {
+		t.Errorf("record of file got %+v", r)
+	}
+	if r = records[3]; r.Kind != "package" || r.Packages[0] != "curl" {
+		t.Errorf("record of package got %+v", r)
+	}
+}
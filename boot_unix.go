@@ -9,64 +9,153 @@
 package shout
 
 import (
-	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
-
-	"github.com/kless/terminal"
 )
 
-const (
-	CMD_WRITE = "/bin/plymouth" // to write during graphical boot
-	PATH      = "/sbin:/bin:/usr/sbin:/usr/bin"
+const PATH = "/sbin:/bin:/usr/sbin:/usr/bin" // minimal, in boot
+
+// == Boot mode
+
+var (
+	bootOnce sync.Once
+	booting  bool
 )
 
-var USE_CMD_WRITE bool
+// Booting reports whether the program is being run during the boot. The mode is
+// detected the first time it is needed, unless it is set by the environment
+// variable SHOUT_BOOT ("1" or "0") or by SetBoot.
+//
+// In boot mode, the variable PATH of the session is set to the minimal PATH. If
+// the mode is detected wrongly, i.e. into a container with some file system
+// which looks like the boot, it can be disabled setting SHOUT_BOOT=0.
+func Booting() bool {
+	bootOnce.Do(func() {
+		if v, err := strconv.ParseBool(os.Getenv("SHOUT_BOOT")); err == nil {
+			booting = v
+		} else {
+			booting = detectBoot()
+		}
+		if booting {
+			setBootEnv()
+		}
+	})
+	return booting
+}
+
+// SetBoot sets the boot mode, instead of detecting it. It has to be called
+// before of running any command.
+func SetBoot(boot bool) {
+	bootOnce.Do(func() {})
+	booting = boot
+	if boot {
+		setBootEnv()
+	}
+}
 
-func init() {
-	// Check if there is an the external command to write.
-	_, err := os.Stat(CMD_WRITE)
-	if os.IsNotExist(err) {
-		return
+// detectBoot reports whether the system is booting: when the program is the
+// process 1, the file systems /proc or /run are not mounted yet, it is into an
+// initramfs, the root is mounted read-only out of a container and without
+// systemd, or it is a service of systemd started before the system is up.
+func detectBoot() bool {
+	pid := os.Getpid()
+	if pid == 1 {
+		return true
 	}
 
-	err = exec.Command(CMD_WRITE, "--ping").Run()
-	if _, ok := err.(*exec.ExitError); !ok {
+	for _, name := range []string{"/proc/self", "/run"} {
+		if _, err := os.Stat(name); os.IsNotExist(err) {
+			return true
+		}
+	}
+	if _, err := os.Stat("/etc/initrd-release"); err == nil {
+		return true
+	}
 
-//	if _, ok, _ := shout.Run(CMD_WRITE + " --ping"); ok {
-		USE_CMD_WRITE = true
+	// A root read-only is not enough: it is used in containers and in systems
+	// with systemd, whose boot is detected below.
+	var fs syscall.Statfs_t
+	if syscall.Statfs("/", &fs) == nil && fs.Flags&syscall.MS_RDONLY != 0 &&
+		!inContainer() && !exists("/run/systemd/system") {
+		return true
 	}
-}
 
-// ReadPassword reads a password directly from terminal or through a third program.
-func ReadPassword(prompt string) (key []byte, err error) {
-	if USE_CMD_WRITE {
-		key, err = exec.Command(CMD_WRITE, "ask-for-password", "--prompt="+prompt).Output()
-	} else {
-		var n int
-		pass := make([]byte, 16)
-
-		n, err = terminal.ReadPassword(syscall.Stdin, pass)
-		if err == nil {
-			copy(key, pass[:n])
+	if os.Getenv("SYSTEMD_EXEC_PID") == strconv.Itoa(pid) && os.Getppid() == 1 {
+		out, _ := exec.Command("systemctl", "is-system-running").Output()
+		switch strings.TrimSpace(string(out)) {
+		case "initializing", "starting":
+			return true
 		}
 	}
+	return false
+}
+
+// inContainer reports whether the program is run into a container.
+func inContainer() bool {
+	return os.Getenv("container") != "" ||
+		exists("/.dockerenv") || exists("/run/.containerenv")
+}
 
-	if err != nil {
-		return nil, fmt.Errorf("ReadPassword: %s", err)
+// exists reports whether the named file exists.
+func exists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+// setBootEnv sets the minimal PATH in the session, and in the process if it
+// has not any one.
+func setBootEnv() {
+	envMu.Lock()
+	_ENV = mergeEnv(_ENV, []string{"PATH=" + PATH})
+	envMu.Unlock()
+
+	if os.Getenv("PATH") == "" {
+		os.Setenv("PATH", PATH)
 	}
-	return
 }
 
-// Writef prints a message using the program in CMD_WRITE or to Stderr.
-func Writef(format string, a ...interface{}) {
-	if USE_CMD_WRITE {
-		exec.Command(CMD_WRITE, "message", "--text="+fmt.Sprintf(format, a...)).Run()
-	} else {
-		fmt.Fprintf(os.Stderr, format, a...)
+// SetupBoot prepares the system to run commands in boot mode, mounting the file
+// systems /proc, /sys and /dev if they are not mounted. It does nothing if it is
+// not in boot mode.
+func SetupBoot() error {
+	if !Booting() {
+		return nil
+	}
+
+	for _, m := range []struct {
+		dir, fsType string
+		flags       uintptr
+	}{
+		{"/proc", "proc", syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC},
+		{"/sys", "sysfs", syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC},
+		{"/dev", "devtmpfs", syscall.MS_NOSUID},
+	} {
+		if isMountPoint(m.dir) {
+			continue
+		}
+		if err := os.MkdirAll(m.dir, 0755); err != nil {
+			return err
+		}
+		if err := syscall.Mount(m.fsType, m.dir, m.fsType, m.flags, ""); err != nil {
+			return &os.PathError{Op: "mount", Path: m.dir, Err: err}
+		}
+		Log.Info("mount", "dir", m.dir, "type", m.fsType)
 	}
+	return nil
 }
 
-// Writefln is like Writef, but adds a new line.
-func Writefln(format string, a ...interface{}) { Writef(format+"\n", a) }
+// isMountPoint reports whether a file system is mounted in dir, which is on a
+// device different to the one of its parent.
+func isMountPoint(dir string) bool {
+	var st, parent syscall.Stat_t
+
+	if syscall.Stat(dir, &st) != nil || syscall.Stat(filepath.Dir(dir), &parent) != nil {
+		return false
+	}
+	return st.Dev != parent.Dev
+}
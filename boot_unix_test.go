@@ -0,0 +1,47 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package shout
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBoot(t *testing.T) {
+	oldEnv, oldBoot := Environ(), Booting()
+	defer func() {
+		SetBoot(oldBoot)
+		envMu.Lock()
+		_ENV = oldEnv
+		envMu.Unlock()
+	}()
+
+	SetBoot(true)
+	if !Booting() {
+		t.Error("SetBoot(true): not in boot mode")
+	}
+	if out, _, err := Run(`sh -c 'echo $PATH'`); err != nil || string(out) != PATH+"\n" {
+		t.Errorf("PATH in boot => got %q (%v), want %q", out, err, PATH)
+	}
+
+	if !isMountPoint("/proc") {
+		t.Error("isMountPoint: /proc is not a mount point")
+	}
+
+	// == The commands are searched in the PATH of the session.
+	dir := t.TempDir()
+	script := filepath.Join(dir, "shout_boot_cmd")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho found\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	Setenv("PATH", dir+":"+PATH)
+	if out, _, err := Run("shout_boot_cmd"); err != nil || string(out) != "found\n" {
+		t.Errorf("command in session PATH => got %q (%v)", out, err)
+	}
+}
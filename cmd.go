@@ -14,8 +14,8 @@ import (
 	"os"
 	"os/exec"
 	"path"
-	"path/filepath"
 	"strings"
+	"time"
 )
 
 // == Errors
@@ -41,13 +41,71 @@ func (e runError) Error() string {
 	if e.debug != "" {
 		e.debug = "\n\tDEBUG: " + e.debug
 	}
-	return fmt.Sprintf("[Shout] `%s`%s\n\t%s: %s", e.cmd, e.debug, e.errType, e.err)
+	return Redact(fmt.Sprintf("[Shout] `%s`%s\n\t%s: %s", e.cmd, e.debug, e.errType, e.err))
+}
+
+// cmdDefault represents the values by default to set in type command.
+type cmdDefault struct {
+	Glob GlobMode // how to handle the file name patterns
+
+	Stdin  io.Reader // standard input of the first command; os.Stdin if it is nil
+	Stdout io.Writer // to copy the output of the last command while it is run
+
+	// == Environment
+	CleanEnv bool     // start from an empty environment instead of the session's one
+	KeepEnv  []string // variables of the session to keep when CleanEnv is set
+	Env      []string // variables to set ("VAR=value") or to unset ("VAR")
+	CLocale  bool     // set LC_ALL=C to get an output independent of the locale
+
+	// == Exit status
+	OkCodes       []int        // exit codes of success; only 0 if it is empty
+	NotFoundCodes []int        // exit codes to return ok=false without error
+	OnStderr      StderrPolicy // what to do with the standard error on success
+
+	Retry Retry // policy to run again the command when it fails
+}
+
+// StderrPolicy represents what to do with the standard error of a command which
+// exits with success.
+type StderrPolicy uint8
+
+const (
+	StderrIgnore StderrPolicy = iota // it is discarded
+	StderrWarn                       // it is logged as a warning
+	StderrError                      // it is returned as an error
+)
+
+// Values by default for type command.
+var _cmdDefault = cmdDefault{Glob: GlobLiteral}
+
+// command represents a command line to run.
+type command struct {
+	cmdDefault
+	line    string
+	noStdin bool // without standard input, as in a pool
+
+	// == Status of the last run
+	exitCode int // -1 if the command was not run or it was killed
+	stderr   []byte
+}
+
+// NewCommand returns a command line to run, whose configuration can be changed
+// before of calling to its method Run.
+func NewCommand(line string) *command {
+	return &command{cmdDefault: _cmdDefault, line: line}
 }
 
 // Run executes external commands with access to shell features such as filename
 // wildcards, shell pipes, environment variables, and expansion of the shortcut
 // character "~" to home directory.
 //
+// The standard input of the first command can be given by a file ("<"), a
+// here-document ("<<" or "<<-" to strip leading tabs), or a here-string ("<<<").
+// The variables in the body of a here-document are expanded unless any part of
+// the delimiter is quoted; the ones in a here-string are expanded when they are
+// not quoted or they are between double quotes. The output of the last command
+// can be redirected to a file (">" or ">>").
+//
 // This function avoids to have execute commands through a shell since an
 // unsanitized input from an untrusted source makes a program vulnerable to
 // shell injection, a serious security flaw which can result in arbitrary
@@ -55,50 +113,134 @@ func (e runError) Error() string {
 //
 // The most of commands return a text in output or an error if any. ok is used
 // in commands like *grep*, *find*, or *cmp* to indicate if the serach is matched.
+//
+// The arguments are expanded in the same order than in the shell: brace
+// expansion ("a{b,c}"), the tilde prefixes ("~", "~user", "~+" and "~-"), and
+// the file name patterns, where "**" matches any number of directories. Nothing
+// is expanded in the quoted characters, and the file name patterns are not
+// expanded in the flags. The tilde prefixes are also expanded after of "=" in
+// flags ("--opt=~/x") and variables ("VAR=~/x:~/y").
 func Run(command string) (output []byte, ok bool, err error) {
+	return NewCommand(command).Run()
+}
+
+// Run executes the command line. The file name patterns are handled according
+// to the field Glob, and the environment is built from the session's one (see
+// Setenv) according to the fields CleanEnv, KeepEnv, Env and CLocale. The command
+// is run again when it fails, according to the field Retry; but it is not
+// retried if Stdin or Stdout are set, since the input would be already consumed
+// and the output would be copied again.
+//
+// ok is true if the exit code of the last command is in OkCodes. An exit code in
+// NotFoundCodes returns ok=false without error, and any other exit code returns
+// an error. If NotFoundCodes is empty, it is used the exit status different to
+// 0 without standard error. The standard error of a command which exits with
+// success is handled according to OnStderr.
+func (cmd *command) Run() (output []byte, ok bool, err error) {
+	for attempt := 1; ; attempt++ {
+		output, ok, err = cmd.run()
+
+		if (err == nil && ok) || attempt >= cmd.Retry.Attempts ||
+			cmd.Stdin != nil || cmd.Stdout != nil ||
+			!cmd.Retry.retryable(err != nil, cmd.exitCode, cmd.stderr) {
+			return
+		}
+
+		delay := cmd.Retry.delay(attempt)
+		Log.Warn("command failed, retrying", "command", cmd.line,
+			"attempt", attempt, "attempts", cmd.Retry.Attempts, "delay", delay,
+			"exit_code", cmd.exitCode, "error", err)
+		time.Sleep(delay)
+	}
+}
+
+// run executes the command line once.
+func (cmd *command) run() (output []byte, ok bool, err error) {
 	var (
-		cmds           []*exec.Cmd
-		outPipes       []io.ReadCloser
-		stdout, stderr bytes.Buffer
+		cmds     []*exec.Cmd
+		outPipes []io.ReadCloser
+		stdout   bytes.Buffer
+		stderr   []*bytes.Buffer // for every command
+		starts   []time.Time
 	)
 
-	commands := strings.Split(command, "|")
-	lastIdxCmd := len(commands) - 1
+	// Save the status
+	cmd.exitCode, cmd.stderr = -1, nil
+	start := time.Now()
 
-	// Check lonely pipes.
-	for _, cmd := range commands {
-		if strings.TrimSpace(cmd) == "" {
-			err = runError{command, "", "ERR", errNoCmdInPipe}
-			return
+	defer func() {
+		if TRACE && err != nil {
+			traceError(err)
+		}
+		for _, b := range stderr {
+			cmd.stderr = append(cmd.stderr, b.Bytes()...)
+		}
+
+		for i := len(cmds) - 1; i >= 0; i-- {
+			if cmds[i].ProcessState != nil {
+				cmd.exitCode = cmds[i].ProcessState.ExitCode()
+				break
+			}
+		}
+
+		if err != nil {
+			Log.Error("run", "command", cmd.line, "exit_code", cmd.exitCode, "error", err)
+		} else {
+			Log.Info("run", "command", cmd.line, "exit_code", cmd.exitCode)
+		}
+
+		if Auditing() {
+			argv := make([][]string, len(cmds))
+			for i, c := range cmds {
+				argv[i] = c.Args
+			}
+			auditRun(cmd.line, argv, time.Since(start), cmd.exitCode,
+				stdout.Bytes(), cmd.stderr, err)
+		}
+	}()
+
+	// The secrets are registered before of any error which shows the line.
+	stages, e := parse(cmd.line)
+	if e != nil {
+		addSecretLine(cmd.line)
+		err = runError{cmd.line, "", "ERR", e}
+		return
+	}
+	for _, st := range stages {
+		for _, w := range st.env {
+			addSecretVars([]string{w.String()})
 		}
 	}
+	lastIdxCmd := len(stages) - 1
 
-	for i, cmd := range commands {
-		cmdEnv := _ENV // evironment variables for each command
+	env, e := cmd.environ()
+	if e != nil {
+		err = runError{cmd.line, "", "ERR", e}
+		return
+	}
+
+	for i, st := range stages {
+		cmdEnv := env  // evironment variables for each command
 		indexArgs := 1 // position where the arguments start
-		fields := strings.Fields(cmd)
-		lastIdxFields := len(fields) - 1
 
-		// == Get environment variables in the first arguments, if any.
-		for j, fCmd := range fields {
-			if fCmd[len(fCmd)-1] == '=' || // VAR= foo
-				(j < lastIdxFields && fields[j+1][0] == '=') { // VAR =foo
-				err = runError{command, "", "ERR", errEnvVar}
-				return
-			}
+		if len(st.env) != 0 {
+			vars := make([]string, len(st.env))
 
-			if strings.ContainsRune(fields[0], '=') {
-				cmdEnv = append([]string{fields[0]}, _ENV...) // Insert the environment variable
-				fields = fields[1:]                           // and it is removed from arguments
-			} else {
-				break
+			for j, w := range st.env {
+				vars[j] = unescape(expandTilde(w.pattern(), tildeAssign))
 			}
+			addSecretVars(vars)
+			cmdEnv = mergeEnv(env, vars)
 		}
-		// ==
 
-		cmdPath, e := exec.LookPath(fields[0])
+		fields := make([]string, len(st.args))
+		for j, w := range st.args {
+			fields[j] = w.String()
+		}
+
+		cmdPath, e := lookPath(fields[0], cmdEnv)
 		if e != nil {
-			err = runError{command, "", "ERR", e}
+			err = runError{cmd.line, "", "ERR", e}
 			return
 		}
 
@@ -111,13 +253,13 @@ func Run(command string) (output []byte, ok bool, err error) {
 			}
 			// It should have an extra command.
 			if j+1 == len(fields) {
-				err = runError{command, "", "ERR", extraCmdError(cmdBase)}
+				err = runError{cmd.line, "", "ERR", extraCmdError(cmdBase)}
 				return
 			}
 
-			nextCmdPath, e := exec.LookPath(fields[j+1])
+			nextCmdPath, e := lookPath(fields[j+1], cmdEnv)
 			if e != nil {
-				err = runError{command, "", "ERR", e}
+				err = runError{cmd.line, "", "ERR", e}
 				return
 			}
 
@@ -128,112 +270,91 @@ func Run(command string) (output []byte, ok bool, err error) {
 		}
 
 		// == Expansion of arguments
-		expand := make(map[int][]string, len(fields))
-
-		for j := indexArgs; j < len(fields); j++ {
-			// Skip flags
-			if fields[j][0] == '-' {
-				continue
-			}
+		args := append([]string{}, fields[:indexArgs]...)
 
-			// Shortcut character "~"
-			if fields[j] == "~" || strings.HasPrefix(fields[j], "~/") {
-				fields[j] = strings.Replace(fields[j], "~", _HOME, 1)
-			}
-
-			// File name wildcards
-			names, e := filepath.Glob(fields[j])
+		for _, w := range st.args[indexArgs:] {
+			names, e := cmd.expand(w)
 			if e != nil {
-				err = runError{command, "", "ERR", e}
+				err = runError{cmd.line, "", "ERR", e}
 				return
 			}
-			if names != nil {
-				expand[j] = names
-			}
-		}
-
-		// Substitute the names generated for the pattern starting from last field.
-		if len(expand) != 0 {
-			for j := len(fields) - indexArgs; j >= indexArgs; j-- {
-				if v, ok := expand[j]; ok {
-					fields = append(fields[:j], append(v, fields[j+1:]...)...)
-				}
-			}
-		}
-
-		// == Handle arguments with quotes
-		hasQuote := false
-		needUpdate := false
-		tmpFields := []string{}
-
-		for j := indexArgs; j < len(fields); j++ {
-			v := fields[j]
-			lastChar := v[len(v)-1]
-
-			if !hasQuote && (v[0] == '\'' || v[0] == '"') {
-				if !needUpdate {
-					needUpdate = true
-				}
-
-				v = v[1:] // skip quote
-
-				if lastChar == '\'' || lastChar == '"' {
-					v = v[:len(v)-1] // remove quote
-				} else {
-					hasQuote = true
-				}
-
-				tmpFields = append(tmpFields, v)
-				continue
-			}
-
-			if hasQuote {
-				if lastChar == '\'' || lastChar == '"' {
-					v = v[:len(v)-1] // remove quote
-					hasQuote = false
-				}
-				tmpFields[len(tmpFields)-1] += " " + v
-				continue
-			}
-
-			tmpFields = append(tmpFields, v)
-		}
-
-		if needUpdate {
-			fields = append(fields[:indexArgs], tmpFields...)
+			args = append(args, names...)
 		}
 
 		// == Create command
 		c := &exec.Cmd{
 			Path: cmdPath,
-			Args: append([]string{fields[0]}, fields[1:]...),
+			Args: args,
 			Env:  cmdEnv,
 		}
 
 		// == Connect pipes
-		outPipe, e := c.StdoutPipe()
-		if e != nil {
-			err = runError{command, "", "ERR", e}
-			return
-		}
-
-		if i == 0 {
-			c.Stdin = os.Stdin
-		} else {
+		switch {
+		case i != 0:
 			c.Stdin = outPipes[i-1] // anterior output
+		case st.hereDoc != nil:
+			body := st.hereDoc.body
+			if st.hereDoc.expand {
+				body = expandVars(body, cmdEnv)
+			}
+			c.Stdin = strings.NewReader(body)
+		case st.in != "":
+			f, e := os.Open(st.in)
+			if e != nil {
+				err = runError{cmd.line, "", "ERR", e}
+				return
+			}
+			defer f.Close()
+			c.Stdin = f
+		case cmd.Stdin != nil:
+			c.Stdin = cmd.Stdin
+		case cmd.noStdin:
+			c.Stdin = strings.NewReader("")
+		default:
+			c.Stdin = os.Stdin
 		}
 
 		// == Buffers
-		c.Stderr = &stderr
+		stderr = append(stderr, new(bytes.Buffer))
+		c.Stderr = stderr[i]
 
 		// Only save the last output
 		if i == lastIdxCmd {
-			c.Stdout = &stdout
+			if st.out != "" {
+				flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+				if st.appendOut {
+					flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+				}
+
+				f, e := os.OpenFile(st.out, flag, 0666)
+				if e != nil {
+					err = runError{cmd.line, "", "ERR", e}
+					return
+				}
+				defer f.Close()
+				c.Stdout = f
+			} else if cmd.Stdout != nil {
+				c.Stdout = io.MultiWriter(&stdout, cmd.Stdout)
+			} else {
+				c.Stdout = &stdout
+			}
+		} else {
+			outPipe, e := c.StdoutPipe()
+			if e != nil {
+				err = runError{cmd.line, "", "ERR", e}
+				return
+			}
+			outPipes = append(outPipes, outPipe)
 		}
 
 		// == Start command
+		if TRACE {
+			traceStart(i, len(stages), c, envChanges(environ(), cmdEnv))
+		}
+		starts = append(starts, time.Now())
+
 		if e := c.Start(); e != nil {
-			err = runError{command,
+			err = runError{cmd.line,
 				fmt.Sprintf("Path: %s | Args: %s", c.Path, c.Args),
 				"Start", fmt.Errorf("%s", c.Stderr)}
 			return
@@ -241,43 +362,180 @@ func Run(command string) (output []byte, ok bool, err error) {
 
 		//
 		cmds = append(cmds, c)
-		outPipes = append(outPipes, outPipe)
 	}
 
-	for _, c := range cmds {
-		if e := c.Wait(); e != nil {
-			_, isExitError := e.(*exec.ExitError)
+	for i, c := range cmds {
+		e := c.Wait()
 
-			// Error type due I/O problems.
-			if !isExitError {
-				err = runError{command,
+		// Error type due I/O problems.
+		if _, isExitError := e.(*exec.ExitError); e != nil && !isExitError {
+			if err == nil {
+				err = runError{cmd.line,
 					fmt.Sprintf("Path: %s | Args: %s", c.Path, c.Args),
 					"Wait", fmt.Errorf("%s", c.Stderr)}
-				return
+			}
+			continue
+		}
+
+		code := c.ProcessState.ExitCode()
+		if TRACE {
+			traceEnd(i, len(cmds), code, time.Since(starts[i]))
+		}
+		stageErr := strings.TrimRight(stderr[i].String(), "\n")
+
+		switch {
+		case cmd.isOk(code):
+			if i == lastIdxCmd {
+				ok = true
+			}
+			if stageErr == "" {
+				break
 			}
 
-			if c.Stderr != nil {
-				if stderr := fmt.Sprintf("%s", c.Stderr); stderr != "" {
-					stderr = strings.TrimRight(stderr, "\n")
-					err = runError{command,
+			switch cmd.OnStderr {
+			case StderrWarn:
+				Log.Warn("standard error on success", "command", cmd.line, "stderr", stageErr)
+			case StderrError:
+				if err == nil {
+					err = runError{cmd.line,
 						fmt.Sprintf("Path: %s | Args: %s", c.Path, c.Args),
-						"Stderr", fmt.Errorf("%s", stderr)}
-					return
+						"Stderr", errors.New(stageErr)}
 				}
 			}
-		} else {
-			ok = true
+
+		// Not found, like in grep. Without NotFoundCodes, it is the exit status
+		// different to 0 without standard error.
+		case cmd.isNotFound(code), len(cmd.NotFoundCodes) == 0 && stageErr == "":
+
+		default:
+			if err != nil {
+				break
+			}
+
+			if stageErr != "" {
+				err = runError{cmd.line,
+					fmt.Sprintf("Path: %s | Args: %s", c.Path, c.Args),
+					"Stderr", errors.New(stageErr)}
+			} else {
+				err = runError{cmd.line,
+					fmt.Sprintf("Path: %s | Args: %s", c.Path, c.Args),
+					"Exit", fmt.Errorf("exit status %d", code)}
+			}
 		}
 	}
 
-	Log.Print(command)
+	if err != nil {
+		return nil, ok, err
+	}
+
 	return stdout.Bytes(), ok, nil
 }
 
+// isOk reports whether the exit code is of success.
+func (cmd *command) isOk(code int) bool {
+	if len(cmd.OkCodes) == 0 {
+		return code == 0
+	}
+	return hasCode(cmd.OkCodes, code)
+}
+
+// isNotFound reports whether the exit code indicates that the search was not
+// matched.
+func (cmd *command) isNotFound(code int) bool {
+	return hasCode(cmd.NotFoundCodes, code)
+}
+
+func hasCode(codes []int, code int) bool {
+	for _, v := range codes {
+		if v == code {
+			return true
+		}
+	}
+	return false
+}
+
+// environ returns the environment for the command, from the session's one and
+// the configuration of the command.
+func (cmd *command) environ() ([]string, error) {
+	env := environ()
+
+	if cmd.CleanEnv {
+		env = filterEnv(env, cmd.KeepEnv)
+	}
+
+	changes := cmd.Env
+	if cmd.CLocale {
+		changes = append(append([]string{}, changes...), "LC_ALL=C")
+	}
+	for _, v := range changes {
+		key := v
+		if i := strings.IndexByte(v, '='); i != -1 {
+			key = v[:i]
+		}
+		if !isName(key) {
+			return nil, errEnvVar
+		}
+	}
+
+	if len(changes) != 0 {
+		addSecretVars(changes)
+		env = mergeEnv(env, changes)
+	}
+	return env, nil
+}
+
+// expand returns the arguments generated from the word w.
+func (cmd *command) expand(w word) ([]string, error) {
+	isFlag := !w[0].quoted && strings.HasPrefix(w[0].s, "-")
+	args := make([]string, 0, 1)
+
+	for _, pattern := range expandBraces(w.pattern()) {
+		if isFlag {
+			pattern = expandTilde(pattern, tildeFlag)
+		} else {
+			pattern = expandTilde(pattern, tildeWord)
+		}
+
+		if isFlag || cmd.Glob == NoGlob || !hasMeta(pattern) {
+			args = append(args, unescape(pattern))
+			continue
+		}
+
+		// File name wildcards
+		names, err := glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+
+		if names == nil {
+			switch cmd.Glob {
+			case NullGlob:
+				continue
+			case FailGlob:
+				return nil, globError(unescape(pattern))
+			}
+			names = []string{unescape(pattern)}
+		}
+		args = append(args, names...)
+	}
+
+	return args, nil
+}
+
 // Runf is like Run, but formats its arguments according to the format,
-// analogous to Printf().
+// analogous to Printf(). The arguments of type Secret are registered to be
+// masked, and their value is passed to the command.
 func Runf(format string, args ...interface{}) ([]byte, bool, error) {
-	return Run(fmt.Sprintf(format, args...))
+	values := make([]interface{}, len(args))
+
+	for i, v := range args {
+		if s, ok := v.(Secret); ok {
+			AddSecret(string(s))
+			v = string(s)
+		}
+		values[i] = v
+	}
+	return Run(fmt.Sprintf(format, values...))
 }
 
 // Sudo calls to command sudo.
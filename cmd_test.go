@@ -7,7 +7,13 @@
 package shout
 
 import (
+	"bytes"
 	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -37,6 +43,25 @@ var testsOutput = []struct {
 	{`sh -c 'echo 123'`, "123\n", true},
 	{`sh -c "echo 123"`, "123\n", true},
 	{`find -name 'cmd*.go'`, "./cmd.go\n./cmd_test.go\n", true},
+	{`echo 'a|b' "c > d"`, "a|b c > d\n", true},
+
+	// expansion
+	{"echo cm*.go do*.go", "cmd.go cmd_test.go doc.go\n", true},
+	{`echo a{b,c{1,2}}d {} \{x,y} "{x,y}"`, "abd ac1d ac2d {} {x,y} {x,y}\n", true},
+	{`echo '*.go' "cm"*.go`, "*.go cmd.go cmd_test.go\n", true},
+	{"echo **/info*.go", "file/info.go file/info_test.go\n", true},
+	{"echo -*.go nomatch*.go", "-*.go nomatch*.go\n", true},
+
+	// here-documents
+	{"cat <<EOF\nfoo\nbar\nEOF", "foo\nbar\n", true},
+	{"cat <<-EOF | wc -l\n\tfoo\n\tbar\n\tEOF\n", "2\n", true},
+	{"SHOUT_X=1 cat <<EOF\n$SHOUT_X ${SHOUT_X} \\$SHOUT_X\nEOF", "1 1 $SHOUT_X\n", true},
+	{"SHOUT_X=1 cat <<'EOF'\n$SHOUT_X\nEOF", "$SHOUT_X\n", true},
+	{"tr a-z A-Z <<< 'foo bar'", "FOO BAR\n", true},
+	{"SHOUT_X=1 cat <<< $SHOUT_X", "1\n", true},
+	{"SHOUT_X=1 cat <<< '$SHOUT_X'", "$SHOUT_X\n", true},
+	{`SHOUT_X=1 cat <<< "v=$SHOUT_X"`, "v=1\n", true},
+	{`SHOUT_X=1 cat <<< "\$SHOUT_X=$SHOUT_X"\ \\n`, "$SHOUT_X=1 \\n\n", true},
 }
 
 var testsError = []struct {
@@ -49,6 +74,13 @@ var testsError = []struct {
 	{"ls| wc|", errNoCmdInPipe},
 	{"ls| |wc", errNoCmdInPipe},
 
+	{"cat <", errRedirect},
+	{"cat <<EOF", hereDocError("EOF")},
+	{"cat <<EOF\nfoo\n", hereDocError("EOF")},
+	{"ls | cat <<< foo", errRedirectIn},
+	{"ls > foo | wc", errRedirectOut},
+	{"echo 'foo", errQuote},
+
 	{"LANG= C find", errEnvVar},
 	{"LANG =C find", errEnvVar},
 
@@ -88,3 +120,144 @@ func TestRun(t *testing.T) {
 		}
 	}
 }
+
+func TestRedirect(t *testing.T) {
+	name := filepath.Join(os.TempDir(), "test-redirect.txt")
+	defer os.Remove(name)
+
+	if _, _, err := Run("cat <<EOF > " + name + "\nfoo\nEOF"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Run("echo bar >> " + name); err != nil {
+		t.Fatal(err)
+	}
+
+	out, _, err := Run("cat < " + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "foo\nbar\n" {
+		t.Errorf("got %q, want %q", out, "foo\nbar\n")
+	}
+
+	if b, _ := ioutil.ReadFile(name); string(b) != "foo\nbar\n" {
+		t.Errorf("file got %q, want %q", b, "foo\nbar\n")
+	}
+}
+
+func TestGlob(t *testing.T) {
+	tests := []struct {
+		mode GlobMode
+		out  string
+		err  error
+	}{
+		{GlobLiteral, "cmd.go nomatch*.go\n", nil},
+		{NullGlob, "cmd.go\n", nil},
+		{FailGlob, "", globError("nomatch*.go")},
+		{NoGlob, "cmd.g? nomatch*.go\n", nil},
+	}
+
+	for _, v := range tests {
+		c := NewCommand("echo cmd.g? nomatch*.go")
+		c.Glob = v.mode
+
+		out, _, err := c.Run()
+		if v.err != nil {
+			if err == nil || err.(runError).err != v.err {
+				t.Errorf("mode %d => error got %v, want %q", v.mode, err, v.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("mode %d => %s", v.mode, err)
+		}
+		if string(out) != v.out {
+			t.Errorf("mode %d => output got %q, want %q", v.mode, out, v.out)
+		}
+	}
+}
+
+func TestTilde(t *testing.T) {
+	home := homeDir()
+	wd, _ := os.Getwd()
+	defer Chdir(wd)
+
+	if err := Chdir("file"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		cmd string
+		out string
+	}{
+		{"echo ~ ~/x '~' \\~/x a~", home + " " + home + "/x ~ ~/x a~\n"},
+		{"echo ~root/x ~nobody_shout/x", "/root/x ~nobody_shout/x\n"},
+		{"echo ~+ ~-", filepath.Join(wd, "file") + " " + wd + "\n"},
+		{"echo --opt=~/x -o~/x", "--opt=" + home + "/x -o~/x\n"},
+		{"SHOUT_X=~/x:~/y:'~' sh -c 'echo $SHOUT_X'", home + "/x:" + home + "/y:~\n"},
+	}
+
+	for _, v := range tests {
+		out, _, err := Run(v.cmd)
+		if err != nil {
+			t.Errorf("`%s` => %s", v.cmd, err)
+		}
+		if string(out) != v.out {
+			t.Errorf("`%s` => output got %q, want %q", v.cmd, out, v.out)
+		}
+	}
+}
+
+func TestRunLog(t *testing.T) {
+	buf := new(bytes.Buffer)
+	oldLog := Log
+	SetLogHandler(NewWriterHandler(buf))
+	defer func() { Log = oldLog }()
+
+	Run("true")
+	Run("sh -c 'echo foo >&2; exit 3'")
+
+	for _, v := range []string{
+		`(?m)level=INFO msg=run command=true exit_code=0$`,
+		`(?m)level=ERROR msg=run command=.*exit 3.* exit_code=3 error=`,
+	} {
+		if !regexp.MustCompile(v).Match(buf.Bytes()) {
+			t.Errorf("log not matched: %s\n%s", v, buf)
+		}
+	}
+}
+
+func TestExitPolicy(t *testing.T) {
+	tests := []struct {
+		cmd      string
+		okCodes  []int
+		notFound []int
+		onStderr StderrPolicy
+		ok       bool
+		err      bool
+	}{
+		{"grep foo shout.go", nil, []int{1}, StderrIgnore, false, false},
+		{"grep foo nofile.go", nil, []int{1}, StderrIgnore, false, true},
+		{"sh -c 'exit 3'", nil, []int{1}, StderrIgnore, false, true},
+		{"sh -c 'exit 3'", nil, nil, StderrIgnore, false, false},
+		{"sh -c 'exit 1'", []int{0, 1}, nil, StderrIgnore, true, false},
+		{"true", []int{1}, []int{2}, StderrIgnore, false, true},
+		{"sh -c 'echo foo >&2'", nil, nil, StderrIgnore, true, false},
+		{"sh -c 'echo foo >&2'", nil, nil, StderrWarn, true, false},
+		{"sh -c 'echo foo >&2'", nil, nil, StderrError, true, true},
+		{"sh -c 'exit 2' | cat", nil, []int{1}, StderrIgnore, true, true},
+	}
+
+	for _, v := range tests {
+		c := NewCommand(v.cmd)
+		c.OkCodes, c.NotFoundCodes, c.OnStderr = v.okCodes, v.notFound, v.onStderr
+
+		_, ok, err := c.Run()
+		if ok != v.ok {
+			t.Errorf("`%s` => ok got %t, want %t", v.cmd, ok, v.ok)
+		}
+		if (err != nil) != v.err || (err != nil && strings.Contains(err.Error(), "%!")) {
+			t.Errorf("`%s` => error got %v", v.cmd, err)
+		}
+	}
+}
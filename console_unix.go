@@ -0,0 +1,162 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// +build linux
+
+package shout
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/kless/shout/prompt"
+)
+
+// ANSI codes of the colours.
+const (
+	_COLOR_RESET  = "\033[0m"
+	_COLOR_RED    = "\033[1;31m"
+	_COLOR_GREEN  = "\033[1;32m"
+	_COLOR_YELLOW = "\033[1;33m"
+)
+
+var (
+	consoleMu  sync.Mutex
+	consoleOut io.Writer = os.Stderr
+	colorOnce  sync.Once
+	useColor   bool
+)
+
+// hasColor reports whether the console output is coloured: when the standard
+// error is a terminal and the variable NO_COLOR is not set.
+func hasColor() bool {
+	colorOnce.Do(func() {
+		useColor = os.Getenv("NO_COLOR") == "" && prompt.IsTerminal(int(os.Stderr.Fd()))
+	})
+	return useColor
+}
+
+// colorize returns s in the color, if the output is coloured.
+func colorize(color, s string) string {
+	if !hasColor() {
+		return s
+	}
+	return color + s + _COLOR_RESET
+}
+
+// plymouthInBoot returns the boot display if it is Plymouth, in boot mode.
+func plymouthInBoot() (*plymouthDisplay, bool) {
+	if !Booting() {
+		return nil, false
+	}
+	d, ok := Display().(*plymouthDisplay)
+	return d, ok
+}
+
+// consoleWrite writes a line in the console, or in Plymouth in boot; mark is
+// the text shown in colour before of the message.
+func consoleWrite(color, mark, msg string) {
+	if d, ok := plymouthInBoot(); ok {
+		d.Message(mark + " " + msg)
+		return
+	}
+
+	consoleMu.Lock()
+	fmt.Fprintf(consoleOut, "%s %s\n", colorize(color, mark), msg)
+	consoleMu.Unlock()
+}
+
+// Info shows an informative message to the user, and logs it.
+func Info(format string, a ...interface{}) {
+	msg := fmt.Sprintf(format, a...)
+	consoleWrite(_COLOR_GREEN, "*", msg)
+	Log.Info(msg)
+}
+
+// Warn shows a warning to the user, and logs it.
+func Warn(format string, a ...interface{}) {
+	msg := fmt.Sprintf(format, a...)
+	consoleWrite(_COLOR_YELLOW, "* WARNING:", msg)
+	Log.Warn(msg)
+}
+
+// Error shows an error to the user, and logs it.
+func Error(format string, a ...interface{}) {
+	msg := fmt.Sprintf(format, a...)
+	consoleWrite(_COLOR_RED, "* ERROR:", msg)
+	Log.Error(msg)
+}
+
+// * * *
+
+// step represents a task shown to the user, which is finished with OK or FAIL.
+type step struct {
+	msg  string
+	done bool
+}
+
+// Step shows the start of a task, i.e. "* Mounting /home ...", which has to be
+// finished calling to OK, FAIL or Done; then it is shown "[ OK ]" or "[FAIL]"
+// at the end of the line.
+func Step(format string, a ...interface{}) *step {
+	s := &step{msg: fmt.Sprintf(format, a...)}
+
+	if d, ok := plymouthInBoot(); ok {
+		d.Status(s.msg)
+	} else {
+		consoleMu.Lock()
+		fmt.Fprintf(consoleOut, "%s %s ...", colorize(_COLOR_GREEN, "*"), s.msg)
+		consoleMu.Unlock()
+	}
+
+	Log.Info(s.msg, "step", "start")
+	return s
+}
+
+// OK finishes the step successfully.
+func (s *step) OK() { s.finish(nil) }
+
+// FAIL finishes the step with the error, which is logged.
+func (s *step) FAIL(err error) {
+	if err == nil {
+		err = fmt.Errorf("%s: failed", s.msg)
+	}
+	s.finish(err)
+}
+
+// Done finishes the step according to err, and returns it.
+func (s *step) Done(err error) error {
+	s.finish(err)
+	return err
+}
+
+func (s *step) finish(err error) {
+	if s.done {
+		return
+	}
+	s.done = true
+
+	mark, color := "[ OK ]", _COLOR_GREEN
+	if err != nil {
+		mark, color = "[FAIL]", _COLOR_RED
+	}
+
+	if d, ok := plymouthInBoot(); ok {
+		d.Message(s.msg + " " + mark)
+	} else {
+		consoleMu.Lock()
+		fmt.Fprintf(consoleOut, " %s\n", colorize(color, mark))
+		consoleMu.Unlock()
+	}
+
+	if err != nil {
+		Log.Error(s.msg, "step", "fail", "error", err)
+	} else {
+		Log.Info(s.msg, "step", "ok")
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package shout
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestConsole(t *testing.T) {
+	out, logBuf := new(bytes.Buffer), new(bytes.Buffer)
+
+	oldOut, oldLog, oldBoot := consoleOut, Log, Booting()
+	consoleOut = out
+	SetLogHandler(NewWriterHandler(logBuf))
+	SetBoot(false)
+	colorOnce.Do(func() {})
+	defer func() {
+		consoleOut, Log, useColor = oldOut, oldLog, false
+		SetBoot(oldBoot)
+	}()
+
+	useColor = false
+	Info("starting %s", "network")
+	Warn("no address")
+	Error("failed")
+	Step("Mounting %s", "/home").OK()
+	Step("Mounting %s", "/srv").FAIL(errors.New("no device"))
+
+	want := "* starting network\n" +
+		"* WARNING: no address\n" +
+		"* ERROR: failed\n" +
+		"* Mounting /home ... [ OK ]\n" +
+		"* Mounting /srv ... [FAIL]\n"
+	if out.String() != want {
+		t.Errorf("output: got\n%s\nwant\n%s", out, want)
+	}
+
+	for _, s := range []string{
+		"level=INFO msg=\"starting network\"",
+		"level=WARN msg=\"no address\"",
+		"level=ERROR msg=failed",
+		"level=INFO msg=\"Mounting /home\" step=ok",
+		"level=ERROR msg=\"Mounting /srv\" step=fail error=\"no device\"",
+	} {
+		if !strings.Contains(logBuf.String(), s) {
+			t.Errorf("log: %q not found in\n%s", s, logBuf)
+		}
+	}
+
+	// == Colour
+	out.Reset()
+	useColor = true
+	if err := Step("Checking").Done(nil); err != nil {
+		t.Fatal(err)
+	}
+	if want = "\033[1;32m*\033[0m Checking ... \033[1;32m[ OK ]\033[0m\n"; out.String() != want {
+		t.Errorf("colour: got %q, want %q", out, want)
+	}
+}
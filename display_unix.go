@@ -0,0 +1,215 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// +build linux
+
+package shout
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/kless/shout/prompt"
+)
+
+// BootDisplay represents the screen where the messages are shown during the
+// boot. It is also a backend for the package prompt.
+type BootDisplay interface {
+	prompt.Backend
+
+	// Status updates the status of the boot.
+	Status(text string) error
+
+	// HideMessage hides a message shown by Message.
+	HideMessage(text string) error
+
+	// Progress shows the percent of the progress.
+	Progress(percent int) error
+
+	// PauseProgress and UnpauseProgress stop and restart the progress of the
+	// boot, i.e. while the user is answering.
+	PauseProgress() error
+	UnpauseProgress() error
+
+	// WatchKeystroke waits until any key in keys is pressed, returning it. If
+	// keys is empty, it returns the first key pressed.
+	WatchKeystroke(keys string) (string, error)
+}
+
+var (
+	displayMu sync.Mutex
+	display   BootDisplay
+)
+
+// Display returns the boot display, which is chosen the first time it is
+// needed: Plymouth (the program in prompt.PLYMOUTH) if it is running, or else
+// the console.
+func Display() BootDisplay {
+	displayMu.Lock()
+	defer displayMu.Unlock()
+
+	if display == nil {
+		if p := prompt.NewPlymouth(prompt.PLYMOUTH); p.Running() {
+			display = NewPlymouthDisplay(prompt.PLYMOUTH)
+		} else {
+			display = NewConsoleDisplay(os.Stdin, os.Stderr)
+		}
+	}
+	return display
+}
+
+// SetDisplay sets the boot display.
+func SetDisplay(d BootDisplay) {
+	displayMu.Lock()
+	display = d
+	displayMu.Unlock()
+}
+
+// == Plymouth
+
+// plymouthDisplay shows the messages through the program of Plymouth.
+type plymouthDisplay struct {
+	prompt.Backend
+	cmd string
+}
+
+// NewPlymouthDisplay returns a boot display which uses the program cmd of
+// Plymouth.
+func NewPlymouthDisplay(cmd string) *plymouthDisplay {
+	return &plymouthDisplay{prompt.NewPlymouth(cmd), cmd}
+}
+
+func (d *plymouthDisplay) Status(text string) error {
+	_, err := d.run("update", "--status="+text)
+	return err
+}
+
+func (d *plymouthDisplay) HideMessage(text string) error {
+	_, err := d.run("hide-message", "--text="+text)
+	return err
+}
+
+func (d *plymouthDisplay) Progress(percent int) error {
+	_, err := d.run("system-update", "--progress="+strconv.Itoa(percent))
+	return err
+}
+
+func (d *plymouthDisplay) PauseProgress() error {
+	_, err := d.run("pause-progress")
+	return err
+}
+
+func (d *plymouthDisplay) UnpauseProgress() error {
+	_, err := d.run("unpause-progress")
+	return err
+}
+
+func (d *plymouthDisplay) WatchKeystroke(keys string) (string, error) {
+	args := []string{"watch-keystroke"}
+	if keys != "" {
+		args = append(args, "--keys="+keys)
+	}
+
+	out, err := d.run(args...)
+	return strings.TrimRight(string(out), "\n"), err
+}
+
+func (d *plymouthDisplay) run(arg ...string) ([]byte, error) {
+	out, err := exec.Command(d.cmd, arg...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("plymouth %s: %s", arg[0], err)
+	}
+	return out, nil
+}
+
+// == Console
+
+// consoleDisplay shows the messages in a console.
+type consoleDisplay struct {
+	prompt.Backend
+	w io.Writer
+}
+
+// NewConsoleDisplay returns a boot display which writes to w and reads the keys
+// and answers from r.
+func NewConsoleDisplay(r io.Reader, w io.Writer) *consoleDisplay {
+	return &consoleDisplay{prompt.NewTerminal(r, w), w}
+}
+
+func (d *consoleDisplay) Status(text string) error {
+	_, err := fmt.Fprintf(d.w, "%s\n", text)
+	return err
+}
+
+// HideMessage does nothing, since the messages can not be removed.
+func (d *consoleDisplay) HideMessage(text string) error { return nil }
+
+func (d *consoleDisplay) Progress(percent int) error {
+	_, err := fmt.Fprintf(d.w, "[%3d%%]\n", percent)
+	return err
+}
+
+// PauseProgress does nothing, since the console has not a progress running.
+func (d *consoleDisplay) PauseProgress() error { return nil }
+
+// UnpauseProgress does nothing, since the console has not a progress running.
+func (d *consoleDisplay) UnpauseProgress() error { return nil }
+
+// WatchKeystroke reads lines until one has any key in keys. Since the console
+// is in line mode, the keys are got after of pressing Enter.
+func (d *consoleDisplay) WatchKeystroke(keys string) (string, error) {
+	for {
+		line, err := d.Ask("")
+		if err != nil {
+			return "", err
+		}
+		for _, r := range line {
+			if keys == "" || strings.ContainsRune(keys, r) {
+				return string(r), nil
+			}
+		}
+	}
+}
+
+// * * *
+
+// ReadPassword reads a password directly from terminal or through a third program.
+//
+// In boot or without a terminal, the password is asked through the password
+// agents of systemd if they are used in the system (see prompt.NewAgent), or
+// else through the boot display.
+//
+// Deprecated: use the package prompt, which has more kinds of questions.
+func ReadPassword(question string) ([]byte, error) {
+	var b prompt.Backend = Display()
+
+	if (Booting() || !prompt.IsTerminal(int(os.Stdin.Fd()))) && prompt.HasAgent() {
+		b = prompt.NewAgent(prompt.ASK_PASSWORD_DIR)
+	}
+
+	key, err := b.AskPassword(question)
+	if err != nil {
+		return nil, fmt.Errorf("ReadPassword: %s", err)
+	}
+	return key, nil
+}
+
+// Writef prints a message using Plymouth in boot, or to Stderr.
+func Writef(format string, a ...interface{}) {
+	if d, ok := Display().(*plymouthDisplay); ok {
+		d.Message(fmt.Sprintf(format, a...))
+	} else {
+		fmt.Fprintf(os.Stderr, format, a...)
+	}
+}
+
+// Writefln is like Writef, but adds a new line.
+func Writefln(format string, a ...interface{}) { Writef(format+"\n", a...) }
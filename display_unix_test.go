@@ -0,0 +1,91 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package shout
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPlymouthDisplay(t *testing.T) {
+	dir := t.TempDir()
+	logName := filepath.Join(dir, "args")
+	stub := filepath.Join(dir, "plymouth")
+
+	// The stub records the arguments, and answers to the questions.
+	err := os.WriteFile(stub, []byte(`#!/bin/sh
+echo "$*" >> `+logName+`
+case "$1" in
+	ask-question) echo answer ;;
+	ask-for-password) echo s3cr3t ;;
+	watch-keystroke) echo y ;;
+esac
+`), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewPlymouthDisplay(stub)
+	d.Status("booting")
+	d.Message("Hello")
+	d.HideMessage("Hello")
+	d.Progress(42)
+	d.PauseProgress()
+	d.UnpauseProgress()
+
+	if s, err := d.Ask("Name?"); err != nil || s != "answer" {
+		t.Errorf("Ask: got %q (%v)", s, err)
+	}
+	if s, err := d.AskPassword("Password:"); err != nil || string(s) != "s3cr3t" {
+		t.Errorf("AskPassword: got %q (%v)", s, err)
+	}
+	if s, err := d.WatchKeystroke("yn"); err != nil || s != "y" {
+		t.Errorf("WatchKeystroke: got %q (%v)", s, err)
+	}
+
+	oldDisplay := display
+	SetDisplay(d)
+	Writefln("%s %d", "line", 1)
+	SetDisplay(oldDisplay)
+
+	b, err := os.ReadFile(logName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `update --status=booting
+display-message --text=Hello
+hide-message --text=Hello
+system-update --progress=42
+pause-progress
+unpause-progress
+ask-question --prompt=Name?
+ask-for-password --prompt=Password:
+watch-keystroke --keys=yn
+display-message --text=line 1
+`
+	if string(b) != want {
+		t.Errorf("arguments: got\n%s\nwant\n%s", b, want)
+	}
+}
+
+func TestConsoleDisplay(t *testing.T) {
+	out := new(bytes.Buffer)
+	d := NewConsoleDisplay(strings.NewReader("abc\nxny\n"), out)
+
+	d.Status("booting")
+	d.Progress(42)
+	if s, err := d.WatchKeystroke("yn"); err != nil || s != "n" {
+		t.Errorf("WatchKeystroke: got %q (%v)", s, err)
+	}
+
+	if want := "booting\n[ 42%]\n"; out.String() != want {
+		t.Errorf("output: got %q, want %q", out, want)
+	}
+}
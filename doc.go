@@ -21,5 +21,67 @@ Configuration
 
 NewEdit creates a new struct, edit, which has a variable, CommentChar,
 with a value by default, '#'. That value is the character used in comments.
+
+NewCommand creates a new struct, command, which has a variable, Glob, with a value
+by default, GlobLiteral. That value indicates how to handle the file name
+patterns: to leave them as they are (GlobLiteral), to remove them (NullGlob), or
+to return an error (FailGlob) when there is not any match; or to don't expand
+them (NoGlob). The fields CleanEnv, KeepEnv, Env and CLocale control the
+environment passed to the command.
+
+
+Environment
+
+The commands get the environment of the session, which is initialized from the
+process and changed with Setenv, Unsetenv, ClearEnv and Chdir, like the commands
+export, unset and cd in the shell.
+
+
+Boot
+
+Booting reports whether the program is run during the boot, which is detected
+the first time it is needed (or set by SHOUT_BOOT or SetBoot; SHOUT_BOOT=0
+disables it if it is detected wrongly). Then the session gets the minimal PATH,
+and SetupBoot mounts /proc, /sys and /dev if they are not mounted yet. The
+commands are searched in the PATH of the session.
+
+The messages, progress and questions during the boot are shown through Display,
+which uses Plymouth (the program in prompt.PLYMOUTH) if it is running, or else
+the console.
+
+
+Console
+
+Info, Warn and Error show messages to the user, and Step shows a task which is
+finished with "[ OK ]" or "[FAIL]". They are coloured if the standard error is
+a terminal and NO_COLOR is not set, shown through Plymouth in boot, and logged.
+
+
+Logging
+
+Log is a leveled logger (log/slog) which discards all records until StartLogger
+is called. Then it writes to a file in LOG_DIR in boot or if LOG_TO_FILE is
+set, which is rotated and reopened on SIGHUP (see NewLogFile); to the journal
+of systemd with fields for every attribute, or to the system log. Another
+backend can be set with SetLogHandler, i.e. NewStderrHandler, NewWriterHandler
+or NewJournalHandler; and the minimum level with LogLevel, or DEBUG to log all.
+The secrets are masked in every backend.
+
+
+Tracing
+
+When TRACE is set, or the environment variable SHOUT_TRACE is "1", every
+command run is written to Log after of the expansion, with its path, arguments,
+changes in the environment, working directory, start time, duration and exit
+status; like "set -x" in the shell. If Log discards them, i.e. before of calling
+StartLogger or after of CloseLogger, the traces are written to the standard
+error.
+
+
+Audit
+
+If AUDIT_FILE is set, StartLogger opens an audit log where every command run,
+file edited (package file) and operation of a package manager (package packager)
+is recorded as a line in JSON, until CloseLogger is called.
 */
 package shout
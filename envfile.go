@@ -0,0 +1,169 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package shout
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+type envFileError struct {
+	name string
+	line int
+	err  error
+}
+
+func (e envFileError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.name, e.line, e.err)
+}
+
+// LoadEnv reads the variables of the named files, like "/etc/default/<service>",
+// "/etc/environment" or ".env", and sets them in the environment of the session.
+// The files are read in order, so a file can refer to the variables of the
+// previous ones. It returns the variables found.
+//
+// See ParseEnv for the format.
+func LoadEnv(names ...string) (map[string]string, error) {
+	vars := make(map[string]string)
+
+	for _, name := range names {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+
+		fileVars, err := parseEnv(f, name)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		changes := make([]string, 0, len(fileVars))
+		for k, v := range fileVars {
+			vars[k] = v
+			changes = append(changes, k+"="+v)
+		}
+		updateEnv(changes...)
+	}
+
+	return vars, nil
+}
+
+// ParseEnv reads variables in format KEY=VALUE, one by line, which can be
+// preceded by "export". The value is handled with the same quoting rules than
+// in Run: between single quotes it is taken literally, between double quotes
+// or without quotes the variables ($VAR or ${VAR}) are expanded, and a quoted
+// value can span several lines. The comments start with '#' at the start of a
+// word.
+//
+// The variables are expanded from the previous ones in the reader or, else,
+// from the environment of the session.
+func ParseEnv(r io.Reader) (map[string]string, error) {
+	return parseEnv(r, "ParseEnv")
+}
+
+func parseEnv(r io.Reader, name string) (map[string]string, error) {
+	vars := make(map[string]string)
+	lookup := func(key string) string {
+		if v, ok := vars[key]; ok {
+			return v
+		}
+		return Getenv(key)
+	}
+
+	scanner := bufio.NewScanner(r)
+	line := ""
+	numLine, startLine := 0, 0
+
+	for scanner.Scan() {
+		numLine++
+		if line == "" {
+			startLine = numLine
+		}
+		line += scanner.Text()
+
+		// Line continuation
+		if strings.HasSuffix(line, `\`) && !strings.HasSuffix(line, `\\`) {
+			line += "\n"
+			continue
+		}
+
+		tokens, err := (&lexer{input: line, comments: true, lookup: lookup}).lex()
+		if err == errQuote { // the value continues in the next line
+			line += "\n"
+			continue
+		}
+		if err != nil {
+			return nil, envFileError{name, startLine, err}
+		}
+		line = ""
+
+		if len(tokens) == 0 {
+			continue
+		}
+
+		key, value, err := parseAssign(tokens)
+		if err != nil {
+			return nil, envFileError{name, startLine, err}
+		}
+		if key != "" {
+			vars[key] = value
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if line != "" {
+		return nil, envFileError{name, startLine, errQuote}
+	}
+	return vars, nil
+}
+
+// parseAssign returns the key and value from the tokens of a line in format
+// [export] KEY=VALUE. The key is empty for a line which only exports variables.
+func parseAssign(tokens []token) (key, value string, err error) {
+	words := make([]word, len(tokens))
+
+	for i, t := range tokens {
+		if t.typ != tokWord {
+			return "", "", errEnvVar
+		}
+		words[i] = t.word
+	}
+
+	if !words[0][0].quoted && words[0].String() == "export" {
+		words = words[1:]
+
+		// Variables only exported, i.e. "export KEY".
+		if len(words) == 0 || strings.IndexByte(words[0][0].s, '=') == -1 {
+			for _, w := range words {
+				if !isName(w.String()) {
+					return "", "", errEnvVar
+				}
+			}
+			return "", "", nil
+		}
+	}
+
+	first := words[0]
+	i := strings.IndexByte(first[0].s, '=')
+	if first[0].quoted || i == -1 || !isName(first[0].s[:i]) {
+		return "", "", errEnvVar
+	}
+
+	values := make([]string, len(words))
+	values[0] = first.String()[i+1:]
+	for j, w := range words[1:] {
+		values[j+1] = w.String()
+	}
+
+	return first[0].s[:i], strings.Join(values, " "), nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package shout
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseEnv(t *testing.T) {
+	input := `# Settings of the service
+
+export SHOUT_A=foo
+SHOUT_B="$SHOUT_A bar" # comment
+SHOUT_C='$SHOUT_A'
+SHOUT_D=${SHOUT_A}-x#y
+SHOUT_E="line 1
+line 2"
+SHOUT_F=a\ b \
+  c
+export SHOUT_A
+`
+	want := map[string]string{
+		"SHOUT_A": "foo",
+		"SHOUT_B": "foo bar",
+		"SHOUT_C": "$SHOUT_A",
+		"SHOUT_D": "foo-x#y",
+		"SHOUT_E": "line 1\nline 2",
+		"SHOUT_F": "a b c",
+	}
+
+	vars, err := ParseEnv(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vars) != len(want) {
+		t.Errorf("got %d variables, want %d", len(vars), len(want))
+	}
+	for k, v := range want {
+		if vars[k] != v {
+			t.Errorf("%s => got %q, want %q", k, vars[k], v)
+		}
+	}
+
+	for _, input := range []string{"SHOUT_A", "1A=foo", "SHOUT_A=a | b", `SHOUT_A="foo`} {
+		if _, err = ParseEnv(strings.NewReader(input)); err == nil {
+			t.Errorf("%q => should get an error", input)
+		}
+	}
+}
+
+func TestLoadEnv(t *testing.T) {
+	name := filepath.Join(os.TempDir(), "test-shout.env")
+	if err := ioutil.WriteFile(name, []byte("SHOUT_A=foo\nSHOUT_B=$SHOUT_A\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(name)
+	defer Unsetenv("SHOUT_A")
+	defer Unsetenv("SHOUT_B")
+
+	vars, err := LoadEnv(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vars["SHOUT_B"] != "foo" {
+		t.Errorf("got %q, want %q", vars["SHOUT_B"], "foo")
+	}
+
+	if out, _, _ := Run(`sh -c 'echo $SHOUT_B'`); string(out) != "foo\n" {
+		t.Errorf("session environment => got %q, want %q", out, "foo\n")
+	}
+}
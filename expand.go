@@ -0,0 +1,451 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package shout
+
+import (
+	"bytes"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// expandVars replaces $VAR and ${VAR} in s by the values in env, as it is done
+// in the body of a here-document. The backslash quotes the characters '\', '$'
+// and '`', and it removes a new line.
+func expandVars(s string, env []string) string {
+	buf := new(bytes.Buffer)
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		if i+1 == len(s) {
+			buf.WriteByte(c)
+			break
+		}
+
+		switch c {
+		case '\\':
+			switch s[i+1] {
+			case '\\', '$', '`':
+				buf.WriteByte(s[i+1])
+				i++
+				continue
+			case '\n':
+				i++
+				continue
+			}
+
+		case '$':
+			if s[i+1] == '{' {
+				if end := strings.IndexByte(s[i+2:], '}'); end != -1 {
+					if name := s[i+2 : i+2+end]; isName(name) {
+						buf.WriteString(getenv(env, name))
+						i += end + 2
+						continue
+					}
+				}
+			} else if n := nameLen(s[i+1:]); n != 0 {
+				buf.WriteString(getenv(env, s[i+1:i+1+n]))
+				i += n
+				continue
+			}
+		}
+		buf.WriteByte(c)
+	}
+
+	return buf.String()
+}
+
+// nameLen returns the length of the variable name at the start of s.
+func nameLen(s string) int {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		if c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' ||
+			(i != 0 && '0' <= c && c <= '9') {
+			continue
+		}
+		return i
+	}
+	return len(s)
+}
+
+// isName reports whether s is a valid name for a variable.
+func isName(s string) bool {
+	return s != "" && nameLen(s) == len(s)
+}
+
+// * * *
+
+// == Tilde expansion
+
+// tildeContext represents where a tilde prefix is searched in a word.
+type tildeContext uint8
+
+const (
+	tildeWord   tildeContext = iota // at the start
+	tildeFlag                       // also after of the first "="
+	tildeAssign                     // also after of the first "=", and after of every ":"
+)
+
+// expandTilde replaces the tilde prefixes in pattern, according to the context.
+func expandTilde(pattern string, context tildeContext) string {
+	pattern = tildePrefix(pattern)
+	if context == tildeWord {
+		return pattern
+	}
+
+	i := strings.IndexByte(pattern, '=')
+	if i == -1 {
+		return pattern
+	}
+	head, value := pattern[:i+1], pattern[i+1:]
+
+	if context == tildeFlag {
+		return head + tildePrefix(value)
+	}
+
+	paths := strings.Split(value, ":")
+	for j, v := range paths {
+		paths[j] = tildePrefix(v)
+	}
+	return head + strings.Join(paths, ":")
+}
+
+// tildePrefix replaces a tilde prefix at the start of pattern:
+//   ~       : the home directory of the current user
+//   ~user   : the home directory of user, from the user database
+//   ~+      : the current working directory
+//   ~-      : the previous working directory, from Chdir
+// The pattern is not modified if the directory can not be got.
+func tildePrefix(pattern string) string {
+	if !strings.HasPrefix(pattern, "~") {
+		return pattern
+	}
+
+	end := strings.IndexByte(pattern, '/')
+	if end == -1 {
+		end = len(pattern)
+	}
+
+	name := pattern[1:end]
+	if strings.IndexByte(name, '\\') != -1 { // quoted characters
+		return pattern
+	}
+
+	dir := ""
+	switch name {
+	case "":
+		dir = homeDir()
+	case "+":
+		dir, _ = os.Getwd()
+	case "-":
+		dir = Getenv("OLDPWD")
+	default:
+		if u, err := user.Lookup(name); err == nil {
+			dir = u.HomeDir
+		}
+	}
+
+	if dir == "" {
+		return pattern
+	}
+	return escapeMeta(dir) + pattern[end:]
+}
+
+// * * *
+
+// == File name generation
+
+// GlobMode represents how to handle the file name patterns.
+type GlobMode uint8
+
+const (
+	// GlobLiteral leaves the pattern as argument when it does not match any file.
+	GlobLiteral GlobMode = iota
+
+	// NullGlob removes the pattern when it does not match any file.
+	NullGlob
+
+	// FailGlob returns an error when the pattern does not match any file.
+	FailGlob
+
+	// NoGlob does not expand the patterns.
+	NoGlob
+)
+
+type globError string
+
+func (e globError) Error() string {
+	return "no match: " + string(e)
+}
+
+// metaChars are the characters to quote in a pattern.
+const metaChars = `\*?[]{},~`
+
+// pattern returns the word like a pattern, where the quoted characters with a
+// special meaning are escaped with a backslash.
+func (w word) pattern() string {
+	buf := new(bytes.Buffer)
+
+	for _, p := range w {
+		if !p.quoted {
+			buf.WriteString(strings.Replace(p.s, `\`, `\\`, -1))
+			continue
+		}
+		buf.WriteString(escapeMeta(p.s))
+	}
+	return buf.String()
+}
+
+// escapeMeta escapes the characters with a special meaning in a pattern.
+func escapeMeta(s string) string {
+	if !strings.ContainsAny(s, metaChars) {
+		return s
+	}
+
+	buf := new(bytes.Buffer)
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(metaChars, s[i]) != -1 {
+			buf.WriteByte('\\')
+		}
+		buf.WriteByte(s[i])
+	}
+	return buf.String()
+}
+
+// unescape removes the backslashes used to quote characters in a pattern.
+func unescape(pattern string) string {
+	if strings.IndexByte(pattern, '\\') == -1 {
+		return pattern
+	}
+
+	buf := new(bytes.Buffer)
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] == '\\' && i+1 < len(pattern) {
+			i++
+		}
+		buf.WriteByte(pattern[i])
+	}
+	return buf.String()
+}
+
+// hasMeta reports whether the pattern has any wildcard not quoted.
+func hasMeta(pattern string) bool {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '*', '?', '[':
+			return true
+		}
+	}
+	return false
+}
+
+// expandBraces generates the patterns for every list between braces, i.e.
+// "a{b,c}d" generates "abd" and "acd". The braces without a comma not quoted,
+// like "{}", are left as they are.
+func expandBraces(pattern string) []string {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+			continue
+		case '{':
+		default:
+			continue
+		}
+
+		end, commas := braceEnd(pattern, i)
+		if end == -1 || len(commas) == 0 {
+			continue
+		}
+
+		prefix := pattern[:i]
+		suffixes := expandBraces(pattern[end+1:])
+		out := make([]string, 0, (len(commas)+1)*len(suffixes))
+
+		start := i + 1
+		for _, sep := range append(commas, end) {
+			for _, alt := range expandBraces(pattern[start:sep]) {
+				for _, suffix := range suffixes {
+					out = append(out, prefix+alt+suffix)
+				}
+			}
+			start = sep + 1
+		}
+		return out
+	}
+
+	return []string{pattern}
+}
+
+// braceEnd returns the position of the brace that closes the one at start,
+// and the position of the commas in its level. It returns -1 if the brace is
+// not closed.
+func braceEnd(pattern string, start int) (end int, commas []int) {
+	depth := 0
+
+	for i := start; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			if depth--; depth == 0 {
+				return i, commas
+			}
+		case ',':
+			if depth == 1 {
+				commas = append(commas, i)
+			}
+		}
+	}
+	return -1, nil
+}
+
+// glob returns the names of all files matching pattern, like filepath.Glob,
+// but where the component "**" matches any number of directories, even none.
+func glob(pattern string) ([]string, error) {
+	if !strings.Contains(pattern, "**") {
+		return filepath.Glob(pattern)
+	}
+
+	var matches []string
+	dir := ""
+	parts := strings.Split(pattern, "/")
+
+	if parts[0] == "" { // absolute path
+		dir = "/"
+		parts = parts[1:]
+	}
+
+	if err := globParts(dir, parts, &matches); err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// globParts adds to matches the files in dir matching the components of a
+// pattern in parts.
+func globParts(dir string, parts []string, matches *[]string) error {
+	if len(parts) == 0 {
+		*matches = append(*matches, dir)
+		return nil
+	}
+
+	part, rest := parts[0], parts[1:]
+
+	// Handle the trailing slash or a repeated one.
+	if part == "" {
+		if len(rest) == 0 && dir != "" {
+			if isDir(dir) {
+				*matches = append(*matches, dir+"/")
+			}
+			return nil
+		}
+		return globParts(dir, rest, matches)
+	}
+
+	if part == "**" {
+		if len(rest) != 0 { // zero directories
+			if err := globParts(dir, rest, matches); err != nil {
+				return err
+			}
+		}
+
+		names, err := readDirNames(dir)
+		if err != nil {
+			return nil
+		}
+		for _, name := range names {
+			sub := joinPath(dir, name)
+
+			if len(rest) == 0 {
+				*matches = append(*matches, sub)
+			}
+			// The symbolic links are not followed to avoid loops.
+			if info, err := os.Lstat(sub); err == nil && info.IsDir() {
+				if err = globParts(sub, parts, matches); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	if !hasMeta(part) {
+		sub := joinPath(dir, unescape(part))
+		if _, err := os.Lstat(sub); err != nil {
+			return nil
+		}
+		if len(rest) != 0 && !isDir(sub) {
+			return nil
+		}
+		return globParts(sub, rest, matches)
+	}
+
+	names, err := readDirNames(dir)
+	if err != nil {
+		return nil
+	}
+	for _, name := range names {
+		ok, err := filepath.Match(part, name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		sub := joinPath(dir, name)
+		if len(rest) != 0 && !isDir(sub) {
+			continue
+		}
+		if err = globParts(sub, rest, matches); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// joinPath joins a directory and a name, without cleaning the result.
+func joinPath(dir, name string) string {
+	switch dir {
+	case "":
+		return name
+	case "/":
+		return "/" + name
+	}
+	return dir + "/" + name
+}
+
+// readDirNames returns the names of the entries in dir.
+func readDirNames(dir string) ([]string, error) {
+	if dir == "" {
+		dir = "."
+	}
+
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return f.Readdirnames(-1)
+}
+
+// isDir reports whether name is a directory, following symbolic links.
+func isDir(name string) bool {
+	info, err := os.Stat(name)
+	return err == nil && info.IsDir()
+}
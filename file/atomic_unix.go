@@ -0,0 +1,200 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// +build linux
+
+package file
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// ATOMIC is used by default to write the files atomically in the edits and in
+// the functions which rewrite a file. It should be unset for special files or
+// for files bind-mounted, where the file can not be replaced by rename. Note
+// that the rename breaks the hard links: the other names keep the old content.
+var ATOMIC = true
+
+// writeFile writes b to the named file. If atomic is set, the content is written
+// in a temporary file in the same directory, with the mode, owner and extended
+// attributes of the file, which is synced and renamed over the original one;
+// so the file is never half-written. A new file gets the mode by default, 0666
+// less the umask.
+//
+// The file is written in place if it is not a regular file, if the temporary
+// file can not be created (i.e. a directory without permission to write), or if
+// it can not be replaced by rename (i.e. a bind mount).
+func writeFile(name string, b []byte, atomic bool) error {
+	var info os.FileInfo
+
+	// Replace the target of a symbolic link, not the link.
+	realName, err := filepath.EvalSymlinks(name)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		// A new file, unless it is a broken symbolic link.
+		if _, e := os.Lstat(name); e == nil || !atomic {
+			return writeInPlace(name, b)
+		}
+		realName = name
+	} else {
+		if info, err = os.Stat(realName); err != nil {
+			return err
+		}
+		if !atomic || !info.Mode().IsRegular() {
+			return writeInPlace(realName, b)
+		}
+	}
+
+	// The temporary file can only be read by the owner until it gets the mode
+	// of the original file.
+	perm := os.FileMode(0666)
+	if info != nil {
+		perm = 0600
+	}
+
+	dir := filepath.Dir(realName)
+	tmp, err := createTemp(dir, "."+filepath.Base(realName)+".", perm)
+	if err != nil {
+		if errors.Is(err, syscall.EACCES) || errors.Is(err, syscall.EPERM) ||
+			errors.Is(err, syscall.EROFS) {
+			return writeInPlace(realName, b)
+		}
+		return err
+	}
+	tmpName := tmp.Name()
+
+	err = func() error {
+		defer tmp.Close()
+
+		if _, err := tmp.Write(b); err != nil {
+			return err
+		}
+		if info != nil {
+			// The owner is changed before of the mode since chown clears the
+			// bits setuid and setgid.
+			if st, ok := info.Sys().(*syscall.Stat_t); ok {
+				if int(st.Uid) != os.Getuid() || int(st.Gid) != os.Getgid() {
+					if err := tmp.Chown(int(st.Uid), int(st.Gid)); err != nil {
+						return err
+					}
+				}
+			}
+			if err := tmp.Chmod(info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)); err != nil {
+				return err
+			}
+			copyXattrs(realName, tmpName)
+		}
+
+		if err := tmp.Sync(); err != nil {
+			return err
+		}
+		return tmp.Close()
+	}()
+	if err != nil {
+		os.Remove(tmpName)
+		// The owner can not be kept without privileges.
+		if os.IsPermission(err) {
+			return writeInPlace(realName, b)
+		}
+		return err
+	}
+
+	if err = os.Rename(tmpName, realName); err != nil {
+		os.Remove(tmpName)
+		if errors.Is(err, syscall.EBUSY) || errors.Is(err, syscall.EXDEV) {
+			return writeInPlace(realName, b)
+		}
+		return err
+	}
+	return syncDir(dir)
+}
+
+// createTemp creates a new file in the directory dir, with a name which starts
+// with prefix, and with the permissions perm less the umask.
+func createTemp(dir, prefix string, perm os.FileMode) (f *os.File, err error) {
+	for i := 0; i < 100; i++ {
+		name := filepath.Join(dir, prefix+strconv.Itoa(os.Getpid())+"."+
+			strconv.FormatInt(time.Now().UnixNano(), 36))
+
+		f, err = os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, perm)
+		if !os.IsExist(err) {
+			return f, err
+		}
+	}
+	return nil, err
+}
+
+// writeInPlace truncates the named file, creating it if it does not exist, and
+// writes b.
+func writeInPlace(name string, b []byte) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	if _, err = f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil && !errors.Is(err, syscall.EINVAL) { // special files
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// syncDir commits the entries of the directory to disk.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	if err = d.Sync(); err != nil && !errors.Is(err, syscall.EINVAL) {
+		return err
+	}
+	return nil
+}
+
+// copyXattrs copies the extended attributes from the file src to dst. It is
+// done as far as possible, since some ones could not be set without
+// privileges or in some file systems.
+func copyXattrs(src, dst string) {
+	size, err := syscall.Listxattr(src, nil)
+	if err != nil || size == 0 {
+		return
+	}
+	list := make([]byte, size)
+	if size, err = syscall.Listxattr(src, list); err != nil {
+		return
+	}
+
+	for _, attr := range bytes.Split(list[:size], []byte{0}) {
+		if len(attr) == 0 {
+			continue
+		}
+		key := string(attr)
+
+		n, err := syscall.Getxattr(src, key, nil)
+		if err != nil {
+			continue
+		}
+		value := make([]byte, n)
+		if n, err = syscall.Getxattr(src, key, value); err != nil {
+			continue
+		}
+		syscall.Setxattr(dst, key, value[:n], 0)
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestAtomic(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "fstab")
+
+	if err := os.WriteFile(name, []byte("/dev/sda1 / ext4 defaults 0 1\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+	hasXattr := syscall.Setxattr(name, "user.shout", []byte("test"), 0) == nil
+	orig := openInfo(t, name) // the file is kept open, so its inode is not reused
+
+	// == Atomic
+	e, err := NewEdit(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = e.Replace([]Replacer{{"defaults", "noatime"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err = e.AppendString("/dev/sda2 /home ext4 defaults 0 2\n"); err != nil {
+		t.Fatal(err)
+	}
+	e.Close()
+
+	if b, _ := os.ReadFile(name); string(b) != "/dev/sda1 / ext4 noatime 0 1\n/dev/sda2 /home ext4 defaults 0 2\n" {
+		t.Errorf("content: got %q", b)
+	}
+	if info, _ := os.Stat(name); os.SameFile(orig, info) {
+		t.Error("the file was not replaced")
+	}
+	if info, _ := os.Stat(name); info.Mode().Perm() != 0640 {
+		t.Errorf("mode: got %v, want 0640", info.Mode().Perm())
+	}
+	if hasXattr {
+		value := make([]byte, 16)
+		if n, err := syscall.Getxattr(name, "user.shout", value); err != nil || string(value[:n]) != "test" {
+			t.Errorf("extended attribute: got %q (%v)", value[:n], err)
+		}
+	}
+	if names, _ := filepath.Glob(filepath.Join(dir, ".fstab.*")); len(names) != 0 {
+		t.Errorf("temporary files not removed: %v", names)
+	}
+
+	// == In place
+	ATOMIC = false
+	defer func() { ATOMIC = true }()
+
+	orig = openInfo(t, name)
+	if err = OverwriteString(name, "none\n"); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(name); !os.SameFile(orig, info) {
+		t.Error("the file was replaced with ATOMIC unset")
+	}
+
+	// == Symbolic link
+	ATOMIC = true
+	link := filepath.Join(dir, "link")
+	if err = os.Symlink(name, link); err != nil {
+		t.Fatal(err)
+	}
+	if err = OverwriteString(link, "by link\n"); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Error("the symbolic link was replaced")
+	}
+	if b, _ := os.ReadFile(name); string(b) != "by link\n" {
+		t.Errorf("content by link: got %q", b)
+	}
+
+	// == New file
+	newName := filepath.Join(dir, "new")
+	if err = writeFile(newName, []byte("new\n"), true); err != nil {
+		t.Fatal(err)
+	}
+	umask := syscall.Umask(0)
+	syscall.Umask(umask)
+	if info, err := os.Stat(newName); err != nil || info.Mode() != 0666&^os.FileMode(umask) {
+		t.Errorf("new file: got mode %v (%v), want %v", info.Mode(), err, 0666&^os.FileMode(umask))
+	}
+	if names, _ := filepath.Glob(filepath.Join(dir, ".new.*")); len(names) != 0 {
+		t.Errorf("new file: temporary files not removed: %v", names)
+	}
+
+	// == Setuid with another owner
+	if os.Getuid() == 0 {
+		suid := filepath.Join(dir, "suid")
+		if err = os.WriteFile(suid, []byte("#!/bin/sh\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = os.Chown(suid, 65534, 65534); err != nil {
+			t.Fatal(err)
+		}
+		if err = os.Chmod(suid, 0755|os.ModeSetuid|os.ModeSetgid); err != nil {
+			t.Fatal(err)
+		}
+		if err = writeFile(suid, []byte("#!/bin/sh\nexit 0\n"), true); err != nil {
+			t.Fatal(err)
+		}
+		if info, _ := os.Stat(suid); info.Mode() != 0755|os.ModeSetuid|os.ModeSetgid {
+			t.Errorf("setuid: got mode %v", info.Mode())
+		}
+	}
+
+	// == Directory without permission to write
+	if os.Getuid() == 0 {
+		t.Log("directory without permission: skipped as root")
+		return
+	}
+	if err = os.Chmod(dir, 0555); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(dir, 0755)
+
+	orig = openInfo(t, name)
+	if err = writeFile(name, []byte("in place\n"), true); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(name); !os.SameFile(orig, info) {
+		t.Error("the file was replaced in a directory without permission")
+	}
+	if b, _ := os.ReadFile(name); string(b) != "in place\n" {
+		t.Errorf("content in place: got %q", b)
+	}
+}
+
+// openInfo opens the named file until the end of the test, returning its
+// information.
+func openInfo(t *testing.T, name string) os.FileInfo {
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info
+}
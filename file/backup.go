@@ -0,0 +1,444 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package file
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kless/shout"
+)
+
+const (
+	_BACKUP_SUFFIX = "+[1-9]~"                   // suffix pattern added to backup's file name
+	_BACKUP_TIME   = "20060102-150405.000000000" // format of the time in backup's file name
+	_BACKUP_MAX    = 9                           // backups kept by default
+)
+
+// BackupNaming represents the schema used to name the backups.
+type BackupNaming int
+
+const (
+	// BackupNumbered names the backups {name}+N~, where N is a number from 1
+	// (the newest one) to Max; the older backups are moved to the next number.
+	BackupNumbered BackupNaming = iota
+
+	// BackupTimestamp names the backups {name}+YYYYMMDD-hhmmss.nnnnnnnnn~,
+	// with the time of the backup.
+	BackupTimestamp
+)
+
+// BackupPolicy represents how the files are backed up before of being edited.
+type BackupPolicy struct {
+	Enabled bool         // create backups?
+	Max     int          // number of backups to keep, pruning the oldest ones; 0 keeps all
+	Naming  BackupNaming // schema for the names
+	Dir     string       // directory to save the backups, mirroring the path of the files; empty for the same directory
+}
+
+// BACKUP is the backup policy used by default.
+var BACKUP = BackupPolicy{Enabled: true, Max: _BACKUP_MAX}
+
+// Backup creates a backup of the named file, using the policy in BACKUP even if
+// it is not enabled.
+//
+// The schema used by default for the new name is: {name}\+[1-9]~
+//   name: The original file name.
+//   + : Character used to separate the file name from rest.
+//   number: A number from 1 to BACKUP.Max (9 by default), using rotation.
+//   ~ : To indicate that it is a backup, just like it is used in Unix systems.
+func Backup(name string) error {
+	_, err := BACKUP.create(name)
+	return err
+}
+
+// backup creates a backup of the named file using the policy in BACKUP,
+// returning its name. The name is empty if the file was not backed up.
+func backup(name string) (string, error) {
+	return BACKUP.backup(name)
+}
+
+// backup creates a backup of the named file if the policy is enabled.
+func (p BackupPolicy) backup(name string) (string, error) {
+	if !p.Enabled {
+		return "", nil
+	}
+	return p.create(name)
+}
+
+// create creates a backup of the named file, returning its name. The name is
+// empty if the file does not exist or it is empty.
+func (p BackupPolicy) create(name string) (string, error) {
+	info, err := os.Stat(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	if info.Size() == 0 {
+		return "", nil
+	}
+
+	base, err := p.base(name)
+	if err != nil {
+		return "", err
+	}
+	if p.Dir != "" {
+		if err = os.MkdirAll(filepath.Dir(base), 0700); err != nil {
+			return "", err
+		}
+	}
+
+	var bakName string
+
+	if p.Naming == BackupTimestamp {
+		bakName = base + "+" + time.Now().Format(_BACKUP_TIME) + "~"
+	} else {
+		if err = p.rotate(base); err != nil {
+			return "", err
+		}
+		bakName = base + "+1~"
+	}
+
+	if err = Copy(name, bakName); err != nil {
+		return "", err
+	}
+	backedUp.add(name)
+	return bakName, p.prune(base)
+}
+
+// base returns the name of the backups without the suffix: the file name in
+// the directory of the policy or in the same one.
+func (p BackupPolicy) base(name string) (string, error) {
+	if p.Dir == "" {
+		return name, nil
+	}
+
+	absName, err := filepath.Abs(name)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(p.Dir, absName), nil
+}
+
+// max returns the number of backups to keep, 0 to keep all.
+func (p BackupPolicy) max() int {
+	if p.Max < 0 {
+		return 0
+	}
+	return p.Max
+}
+
+// rotate moves every numbered backup to the next number, so the number 1 is
+// free for the new one. The backup with the number Max is removed, unless all
+// are kept.
+func (p BackupPolicy) rotate(base string) error {
+	max := p.max()
+
+	if max == 0 {
+		names, err := p.list(base)
+		if err != nil {
+			return err
+		}
+		if len(names) == 0 {
+			return nil
+		}
+		last := names[len(names)-1]
+		if max, err = strconv.Atoi(last[len(base)+1 : len(last)-1]); err != nil {
+			return err
+		}
+		max++
+	}
+
+	if err := os.Remove(base + "+" + strconv.Itoa(max) + "~"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for i := max - 1; i > 0; i-- {
+		err := os.Rename(base+"+"+strconv.Itoa(i)+"~", base+"+"+strconv.Itoa(i+1)+"~")
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// prune removes the oldest backups which are not kept.
+func (p BackupPolicy) prune(base string) error {
+	max := p.max()
+	if max == 0 {
+		return nil
+	}
+
+	names, err := p.list(base)
+	if err != nil {
+		return err
+	}
+	for i := max; i < len(names); i++ {
+		if err = os.Remove(names[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// list returns the names of the backups with the base name according to the
+// naming, from the newest one to the oldest.
+func (p BackupPolicy) list(base string) ([]string, error) {
+	files, err := filepath.Glob(escapeGlob(base) + "+*~")
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		suffix := f[len(base)+1 : len(f)-1]
+
+		if p.Naming == BackupTimestamp {
+			if _, err := time.Parse(_BACKUP_TIME, suffix); err == nil {
+				names = append(names, f)
+			}
+		} else if n, err := strconv.Atoi(suffix); err == nil && n > 0 {
+			names = append(names, f)
+		}
+	}
+
+	if p.Naming == BackupTimestamp {
+		sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	} else {
+		sort.Slice(names, func(i, j int) bool {
+			ni, _ := strconv.Atoi(names[i][len(base)+1 : len(names[i])-1])
+			nj, _ := strconv.Atoi(names[j][len(base)+1 : len(names[j])-1])
+			return ni < nj
+		})
+	}
+	return names, nil
+}
+
+// escapeGlob escapes the meta-characters of filepath.Match in name.
+func escapeGlob(name string) string {
+	return strings.NewReplacer(`*`, `\*`, `?`, `\?`, `[`, `\[`, `\`, `\\`).Replace(name)
+}
+
+// == Restoring
+
+// BackupInfo represents a backup of a file.
+type BackupInfo struct {
+	Name string    // file name of the backup
+	Time time.Time // when it was created
+}
+
+// backedUp has the absolute names of the files backed up by this process.
+var backedUp = &fileSet{names: make(map[string]bool)}
+
+type fileSet struct {
+	sync.Mutex
+	names map[string]bool
+}
+
+func (s *fileSet) add(name string) {
+	if absName, err := filepath.Abs(name); err == nil {
+		s.Lock()
+		s.names[absName] = true
+		s.Unlock()
+	}
+}
+
+func (s *fileSet) list() []string {
+	s.Lock()
+	defer s.Unlock()
+
+	names := make([]string, 0, len(s.names))
+	for k := range s.names {
+		names = append(names, k)
+	}
+	return names
+}
+
+// Backups returns the backups of the named file using the policy in BACKUP,
+// from the newest one to the oldest.
+func Backups(name string) ([]BackupInfo, error) {
+	return BACKUP.Backups(name)
+}
+
+// Backups returns the backups of the named file, from the newest one to the
+// oldest.
+func (p BackupPolicy) Backups(name string) ([]BackupInfo, error) {
+	base, err := p.base(name)
+	if err != nil {
+		return nil, err
+	}
+	names, err := p.list(base)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]BackupInfo, 0, len(names))
+	for _, v := range names {
+		info := BackupInfo{Name: v}
+
+		if p.Naming == BackupTimestamp {
+			info.Time, _ = time.ParseInLocation(_BACKUP_TIME, v[len(base)+1:len(v)-1], time.Local)
+		} else {
+			// The rotation renames the backups, which keeps the modification time.
+			fi, err := os.Stat(v)
+			if err != nil {
+				return nil, err
+			}
+			info.Time = fi.ModTime()
+		}
+		list = append(list, info)
+	}
+	return list, nil
+}
+
+// DiffBackup returns the differences in unified format between the backup
+// bakName and the current content of the named file.
+func DiffBackup(name, bakName string) (string, error) {
+	return DiffFiles(bakName, name)
+}
+
+// Restore replaces atomically the named file with the content of its backup
+// bakName, using the policy in BACKUP.
+func Restore(name, bakName string) error {
+	return BACKUP.Restore(name, bakName)
+}
+
+// Restore replaces the named file with the content of its backup bakName; it
+// is replaced atomically, unless ATOMIC is unset. The current content is backed
+// up before, even if the policy is not enabled. In dry-run mode, the diff is
+// printed instead.
+func (p BackupPolicy) Restore(name, bakName string) (err error) {
+	// The backup is read before of backing up the current file, since the
+	// rotation could rename it.
+	b, err := ioutil.ReadFile(bakName)
+	if err != nil {
+		return err
+	}
+	bakInfo, err := os.Stat(bakName)
+	if err != nil {
+		return err
+	}
+	if ok, err := mustWrite(name, "Restore", b); !ok {
+		return err
+	}
+
+	_, err = os.Stat(name)
+	exist := err == nil
+
+	newBak, err := p.create(name)
+	if err != nil {
+		return err
+	}
+
+	if shout.Auditing() {
+		before := checksum(name)
+		defer func() { shout.AuditEdit(name, "Restore", newBak, before, checksum(name), err) }()
+	}
+
+	if err = writeFile(name, b, ATOMIC); err != nil {
+		return err
+	}
+	if !exist {
+		return os.Chmod(name, bakInfo.Mode().Perm())
+	}
+	return nil
+}
+
+// RestoreSince restores the files changed since the time t using the policy
+// in BACKUP. See BackupPolicy.RestoreSince.
+func RestoreSince(t time.Time) ([]string, error) {
+	return BACKUP.RestoreSince(t)
+}
+
+// RestoreSince restores the files changed since the time t to the content they
+// had at that time, that is the oldest backup created since then. It is used to
+// roll back the changes done by a script which has failed.
+//
+// The files are the ones backed up by this process and, if Dir is set, the
+// ones which have backups into it. It returns the names of the files restored,
+// or the ones which would be restored in dry-run mode.
+func (p BackupPolicy) RestoreSince(t time.Time) ([]string, error) {
+	names, err := p.backedUpFiles()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	var restored []string
+	for _, name := range names {
+		list, err := p.Backups(name)
+		if err != nil {
+			return restored, err
+		}
+
+		var bakName string
+		for _, v := range list {
+			if v.Time.Before(t) {
+				break
+			}
+			bakName = v.Name
+		}
+		if bakName == "" {
+			continue
+		}
+
+		if err = p.Restore(name, bakName); err != nil {
+			return restored, err
+		}
+		restored = append(restored, name)
+	}
+	return restored, nil
+}
+
+// backedUpFiles returns the absolute names of the files backed up by this
+// process, and the ones with backups into Dir.
+func (p BackupPolicy) backedUpFiles() ([]string, error) {
+	names := backedUp.list()
+	if p.Dir == "" {
+		return names, nil
+	}
+
+	seen := make(map[string]bool, len(names))
+	for _, v := range names {
+		seen[v] = true
+	}
+
+	dir, err := filepath.Abs(p.Dir)
+	if err != nil {
+		return nil, err
+	}
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(path, "~") {
+			return nil
+		}
+
+		i := strings.LastIndex(path, "+")
+		if i == -1 {
+			return nil
+		}
+		name := strings.TrimPrefix(path[:i], dir)
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+		return nil
+	})
+	return names, err
+}
@@ -0,0 +1,233 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackup(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "hosts")
+
+	// backupN writes the content n in the file, and backs it up.
+	backupN := func(p BackupPolicy, n int) string {
+		if err := os.WriteFile(name, []byte(strconv.Itoa(n)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		bakName, err := p.backup(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bakName
+	}
+
+	// == Numbered, with rotation beyond 9
+	p := BackupPolicy{Enabled: true, Max: 9}
+	for i := 1; i <= 12; i++ {
+		backupN(p, i)
+	}
+
+	for i := 1; i <= 9; i++ {
+		b, err := os.ReadFile(name + "+" + strconv.Itoa(i) + "~")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := strconv.Itoa(13 - i); string(b) != want {
+			t.Errorf("numbered: backup %d got %q, want %q", i, b, want)
+		}
+	}
+	if _, err := os.Stat(name + "+10~"); !os.IsNotExist(err) {
+		t.Error("numbered: backup 10 should not exist")
+	}
+
+	// == Keep all
+	p.Max = 0
+	backupN(p, 13)
+	backupN(p, 14)
+
+	if b, _ := os.ReadFile(name + "+11~"); string(b) != "4" {
+		t.Errorf("keep all: backup 11 got %q, want %q", b, "4")
+	}
+	if b, _ := os.ReadFile(name + "+1~"); string(b) != "14" {
+		t.Errorf("keep all: backup 1 got %q, want %q", b, "14")
+	}
+
+	// == Pruning
+	p.Max = 3
+	backupN(p, 15)
+
+	names, err := p.list(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 3 {
+		t.Errorf("pruning: got %d backups, want 3", len(names))
+	}
+	if b, _ := os.ReadFile(names[0]); string(b) != "15" {
+		t.Errorf("pruning: newest backup got %q, want %q", b, "15")
+	}
+
+	// == Timestamps
+	for _, v := range names {
+		os.Remove(v)
+	}
+	p = BackupPolicy{Enabled: true, Max: 2, Naming: BackupTimestamp}
+	for i := 1; i <= 3; i++ {
+		backupN(p, i)
+	}
+
+	if names, err = p.list(name); err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 {
+		t.Fatalf("timestamp: got %d backups, want 2", len(names))
+	}
+	if b, _ := os.ReadFile(names[0]); string(b) != "3" {
+		t.Errorf("timestamp: newest backup got %q, want %q", b, "3")
+	}
+	if b, _ := os.ReadFile(names[1]); string(b) != "2" {
+		t.Errorf("timestamp: oldest backup got %q, want %q", b, "2")
+	}
+
+	// == Directory
+	p = BackupPolicy{Enabled: true, Dir: filepath.Join(dir, "backup")}
+	bakName := backupN(p, 1)
+
+	if want := filepath.Join(p.Dir, name) + "+1~"; bakName != want {
+		t.Errorf("directory: got %q, want %q", bakName, want)
+	}
+	if _, err = os.Stat(bakName); err != nil {
+		t.Error(err)
+	}
+
+	// == Disabled
+	if bakName = backupN(BackupPolicy{}, 1); bakName != "" {
+		t.Errorf("disabled: got backup %q", bakName)
+	}
+
+	e, err := NewEditBackup(name, BackupPolicy{Dir: p.Dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Close()
+
+	if names, _ = p.list(filepath.Join(p.Dir, name)); len(names) != 1 {
+		t.Errorf("disabled: got %d backups, want 1", len(names))
+	}
+}
+
+func TestRestore(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "fstab")
+	p := BackupPolicy{Enabled: true, Max: 9}
+
+	for _, v := range []string{"one\n", "two\n", "three\n"} {
+		if err := os.WriteFile(name, []byte(v), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := p.backup(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// == List
+	list, err := p.Backups(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 3 {
+		t.Fatalf("Backups: got %d, want 3", len(list))
+	}
+	if list[0].Name != name+"+1~" || list[0].Time.IsZero() {
+		t.Errorf("Backups: got %+v", list[0])
+	}
+
+	// == Diff
+	out, err := DiffBackup(name, list[2].Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "--- " + list[2].Name + "\n+++ " + name + "\n@@ -1 +1 @@\n-one\n+three\n"; out != want {
+		t.Errorf("DiffBackup: got %q, want %q", out, want)
+	}
+
+	// == Restore
+	if err = p.Restore(name, list[2].Name); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(name); string(b) != "one\n" {
+		t.Errorf("Restore: got %q", b)
+	}
+	// The current version is backed up.
+	if b, _ := os.ReadFile(name + "+1~"); string(b) != "three\n" {
+		t.Errorf("Restore: backup got %q", b)
+	}
+
+	// == Restore since
+	since := time.Now()
+	time.Sleep(10 * time.Millisecond) // the resolution of the modification time
+
+	for _, v := range []string{"four\n", "five\n"} {
+		e, err := NewEditBackup(name, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = e.Replace([]Replacer{{"[a-z]+", strings.TrimSpace(v)}})
+		e.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	restored, err := p.RestoreSince(since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restored) != 1 || restored[0] != name {
+		t.Errorf("RestoreSince: got %q", restored)
+	}
+	if b, _ := os.ReadFile(name); string(b) != "one\n" {
+		t.Errorf("RestoreSince: got %q", b)
+	}
+}
+
+func TestRestoreDryRun(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "hosts")
+	p := BackupPolicy{Enabled: true, Max: 9}
+
+	for _, v := range []string{"one\n", "two\n"} {
+		if err := os.WriteFile(name, []byte(v), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := p.backup(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	buf := new(strings.Builder)
+	DIFF_OUTPUT, DRY_RUN = buf, true
+	defer func() { DIFF_OUTPUT, DRY_RUN = os.Stdout, false }()
+
+	if err := p.Restore(name, name+"+2~"); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(name); string(b) != "two\n" {
+		t.Errorf("the file was restored: got %q", b)
+	}
+	if names, _ := p.list(name); len(names) != 2 {
+		t.Errorf("got %d backups, want 2", len(names))
+	}
+	if !strings.Contains(buf.String(), "-two\n+one\n") {
+		t.Errorf("diff not printed: %q", buf)
+	}
+}
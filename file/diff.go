@@ -0,0 +1,354 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package file
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/kless/shout"
+)
+
+var (
+	// DIFF_CONTEXT is the number of unchanged lines shown around every change
+	// in the unified diffs.
+	DIFF_CONTEXT = 3
+
+	// DRY_RUN is used by default to print the diff of every change in
+	// DIFF_OUTPUT, instead of writing the file.
+	DRY_RUN bool
+
+	// LOG_DIFF is used by default to log the diff of every change.
+	LOG_DIFF bool
+
+	// DIFF_OUTPUT is where the diffs are printed in dry-run mode.
+	DIFF_OUTPUT io.Writer = os.Stdout
+)
+
+// Diff returns the differences between a and b in unified format, like
+// "diff -u"; oldName and newName are the names shown in the header. It returns
+// an empty string if the contents are equal.
+func Diff(oldName, newName string, a, b []byte) string {
+	if bytes.Equal(a, b) {
+		return ""
+	}
+	ops := diffLines(splitLines(a), splitLines(b))
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", oldName, newName)
+
+	for _, h := range hunks(ops, DIFF_CONTEXT) {
+		aStart, bStart, aLen, bLen := 0, 0, 0, 0
+
+		for _, op := range ops[:h[0]] {
+			if op.kind != '+' {
+				aStart++
+			}
+			if op.kind != '-' {
+				bStart++
+			}
+		}
+		for _, op := range ops[h[0]:h[1]] {
+			if op.kind != '+' {
+				aLen++
+			}
+			if op.kind != '-' {
+				bLen++
+			}
+		}
+
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n", hunkRange(aStart, aLen), hunkRange(bStart, bLen))
+		for _, op := range ops[h[0]:h[1]] {
+			buf.WriteByte(op.kind)
+			buf.WriteString(op.line)
+			if len(op.line) == 0 || op.line[len(op.line)-1] != '\n' {
+				buf.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+	return buf.String()
+}
+
+// DiffFiles returns the differences between the named files in unified
+// format. A file which does not exist is handled like an empty one.
+func DiffFiles(oldName, newName string) (string, error) {
+	a, err := readFile(oldName)
+	if err != nil {
+		return "", err
+	}
+	b, err := readFile(newName)
+	if err != nil {
+		return "", err
+	}
+	return Diff(oldName, newName, a, b), nil
+}
+
+// readFile is like ioutil.ReadFile, but returns no error if the file does not
+// exist.
+func readFile(name string) ([]byte, error) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil && os.IsNotExist(err) {
+		return nil, nil
+	}
+	return b, err
+}
+
+// showDiff logs the diff of an operation in the named file if logDiff is set,
+// and prints it in DIFF_OUTPUT if dryRun is set.
+func showDiff(name, operation, diff string, dryRun, logDiff bool) {
+	if diff == "" {
+		return
+	}
+	if logDiff {
+		shout.Log.Info("file changed", "file", name, "operation", operation, "diff", diff)
+	}
+	if dryRun {
+		fmt.Fprint(DIFF_OUTPUT, diff)
+	}
+}
+
+// mustWrite shows the diff of writing b in the named file, according to
+// DRY_RUN and LOG_DIFF. It reports whether the file has to be written.
+func mustWrite(name, operation string, b []byte) (bool, error) {
+	if DRY_RUN || LOG_DIFF {
+		old, err := readFile(name)
+		if err != nil {
+			return false, err
+		}
+		showDiff(name, operation, Diff(name, name, old, b), DRY_RUN, LOG_DIFF)
+	}
+	return !DRY_RUN, nil
+}
+
+// * * *
+
+// diffOp represents an operation to transform a text into another one.
+type diffOp struct {
+	kind byte   // ' ' for a line unchanged, '-' for a line removed, '+' for one added
+	line string // with the line ending, if any
+}
+
+// splitLines splits b into lines, keeping the line endings.
+func splitLines(b []byte) []string {
+	var lines []string
+
+	for len(b) != 0 {
+		i := bytes.IndexByte(b, '\n')
+		if i == -1 {
+			lines = append(lines, string(b))
+			break
+		}
+		lines = append(lines, string(b[:i+1]))
+		b = b[i+1:]
+	}
+	return lines
+}
+
+// diffLines returns the shortest edit script to transform the lines in a into
+// the ones in b, using the algorithm of Myers in linear space: the middle snake
+// of the shortest path splits the problem in two ones, recursively.
+func diffLines(a, b []string) []diffOp {
+	size := len(a) + len(b) + 3
+	d := &differ{
+		a:   a,
+		b:   b,
+		ops: make([]diffOp, 0, len(a)+len(b)),
+		v1:  make([]int, size),
+		v2:  make([]int, size),
+	}
+	d.compare(0, len(a), 0, len(b))
+	return d.ops
+}
+
+// differ has the state to get the operations between two lists of lines. The
+// furthest paths, v1 and v2, are reused in every step.
+type differ struct {
+	a, b   []string
+	ops    []diffOp
+	v1, v2 []int
+}
+
+// compare adds the operations to transform a[aLo:aHi] into b[bLo:bHi].
+func (d *differ) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		d.ops = append(d.ops, diffOp{' ', d.a[aLo]})
+		aLo++
+		bLo++
+	}
+	suffix := 0
+	for aLo < aHi-suffix && bLo < bHi-suffix && d.a[aHi-1-suffix] == d.b[bHi-1-suffix] {
+		suffix++
+	}
+	aHi -= suffix
+	bHi -= suffix
+
+	switch {
+	case aLo == aHi:
+		for ; bLo < bHi; bLo++ {
+			d.ops = append(d.ops, diffOp{'+', d.b[bLo]})
+		}
+	case bLo == bHi:
+		for ; aLo < aHi; aLo++ {
+			d.ops = append(d.ops, diffOp{'-', d.a[aLo]})
+		}
+	default:
+		d.bisect(aLo, aHi, bLo, bHi)
+	}
+
+	for i := aHi; i < aHi+suffix; i++ {
+		d.ops = append(d.ops, diffOp{' ', d.a[i]})
+	}
+}
+
+// bisect finds the middle snake of a[aLo:aHi] and b[bLo:bHi], walking the
+// paths forward from the start and backward from the end until they overlap,
+// and compares the two halves.
+func (d *differ) bisect(aLo, aHi, bLo, bHi int) {
+	n, m := aHi-aLo, bHi-bLo
+	maxD := (n + m + 1) / 2
+	off, length := maxD, 2*maxD+2
+	v1, v2 := d.v1[:length], d.v2[:length]
+
+	for i := range v1 {
+		v1[i], v2[i] = -1, -1
+	}
+	v1[off+1], v2[off+1] = 0, 0
+
+	delta := n - m
+	front := delta%2 != 0 // the forward path finds the overlap
+	// Diagonals out of the grid, to skip.
+	k1start, k1end, k2start, k2end := 0, 0, 0, 0
+
+	for D := 0; D < maxD; D++ {
+		// == Forward
+		for k1 := -D + k1start; k1 <= D-k1end; k1 += 2 {
+			i := off + k1
+			var x1 int
+			if k1 == -D || (k1 != D && v1[i-1] < v1[i+1]) {
+				x1 = v1[i+1] // down: insertion
+			} else {
+				x1 = v1[i-1] + 1 // right: deletion
+			}
+			y1 := x1 - k1
+
+			for x1 < n && y1 < m && d.a[aLo+x1] == d.b[bLo+y1] {
+				x1++
+				y1++
+			}
+			v1[i] = x1
+
+			switch {
+			case x1 > n:
+				k1end += 2
+			case y1 > m:
+				k1start += 2
+			case front:
+				if j := off + delta - k1; j >= 0 && j < length && v2[j] != -1 && x1 >= n-v2[j] {
+					d.compare(aLo, aLo+x1, bLo, bLo+y1)
+					d.compare(aLo+x1, aHi, bLo+y1, bHi)
+					return
+				}
+			}
+		}
+
+		// == Backward
+		for k2 := -D + k2start; k2 <= D-k2end; k2 += 2 {
+			i := off + k2
+			var x2 int
+			if k2 == -D || (k2 != D && v2[i-1] < v2[i+1]) {
+				x2 = v2[i+1]
+			} else {
+				x2 = v2[i-1] + 1
+			}
+			y2 := x2 - k2
+
+			for x2 < n && y2 < m && d.a[aHi-1-x2] == d.b[bHi-1-y2] {
+				x2++
+				y2++
+			}
+			v2[i] = x2
+
+			switch {
+			case x2 > n:
+				k2end += 2
+			case y2 > m:
+				k2start += 2
+			case !front:
+				if j := off + delta - k2; j >= 0 && j < length && v1[j] != -1 {
+					x1 := v1[j]
+					y1 := x1 - (j - off)
+					if x1 >= n-x2 {
+						d.compare(aLo, aLo+x1, bLo, bLo+y1)
+						d.compare(aLo+x1, aHi, bLo+y1, bHi)
+						return
+					}
+				}
+			}
+		}
+	}
+
+	// There are no lines in common.
+	for i := aLo; i < aHi; i++ {
+		d.ops = append(d.ops, diffOp{'-', d.a[i]})
+	}
+	for j := bLo; j < bHi; j++ {
+		d.ops = append(d.ops, diffOp{'+', d.b[j]})
+	}
+}
+
+// hunks returns the ranges [start, end) of the operations to show in every
+// hunk, with context lines around the changes.
+func hunks(ops []diffOp, context int) [][2]int {
+	var list [][2]int
+
+	for i := 0; i < len(ops); i++ {
+		if ops[i].kind == ' ' {
+			continue
+		}
+
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		// Join the changes separated by less than the context of both.
+		end, equal := i, 0
+		for j := i; j < len(ops) && equal <= 2*context; j++ {
+			if ops[j].kind == ' ' {
+				equal++
+			} else {
+				equal = 0
+				end = j
+			}
+		}
+		end += context + 1
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		if len(list) != 0 && start <= list[len(list)-1][1] {
+			list[len(list)-1][1] = end
+		} else {
+			list = append(list, [2]int{start, end})
+		}
+		i = end - 1
+	}
+	return list
+}
+
+// hunkRange returns the range of lines of a hunk, in the format of "diff -u".
+func hunkRange(start, length int) string {
+	switch length {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
@@ -0,0 +1,218 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package file
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kless/shout"
+)
+
+var diffTests = []struct {
+	a, b, out string
+}{
+	{"a\nb\n", "a\nb\n", ""},
+	{
+		"a\nb\nc\n", "a\nB\nc\n",
+		"--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+	},
+	{
+		"", "a\n",
+		"--- old\n+++ new\n@@ -0,0 +1 @@\n+a\n",
+	},
+	{
+		"a\nb", "a\nb\n",
+		"--- old\n+++ new\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+	},
+	// Two hunks, since the changes are far.
+	{
+		"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n", "0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+		"--- old\n+++ new\n@@ -1,3 +1,4 @@\n+0\n 1\n 2\n 3\n@@ -7,4 +8,3 @@\n 7\n 8\n 9\n-10\n",
+	},
+	// One hunk, since the changes are near.
+	{
+		"1\n2\n3\n4\n5\n6\n", "1\n2\nx\n4\n5\ny\n",
+		"--- old\n+++ new\n@@ -1,6 +1,6 @@\n 1\n 2\n-3\n+x\n 4\n 5\n-6\n+y\n",
+	},
+}
+
+func TestDiff(t *testing.T) {
+	for i, tt := range diffTests {
+		if out := Diff("old", "new", []byte(tt.a), []byte(tt.b)); out != tt.out {
+			t.Errorf("#%d: got\n%s\nwant\n%s", i, out, tt.out)
+		}
+	}
+}
+
+// TestDiffLines checks that the edit script of random texts is valid and the
+// shortest one, comparing it with the longest common subsequence.
+func TestDiffLines(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	text := func() []string {
+		lines := make([]string, r.Intn(20))
+		for i := range lines {
+			lines[i] = string(rune('a' + r.Intn(4)))
+		}
+		return lines
+	}
+
+	for i := 0; i < 1000; i++ {
+		a, b := text(), text()
+		var gotA, gotB []string
+		edits := 0
+
+		for _, op := range diffLines(a, b) {
+			if op.kind != '+' {
+				gotA = append(gotA, op.line)
+			}
+			if op.kind != '-' {
+				gotB = append(gotB, op.line)
+			}
+			if op.kind != ' ' {
+				edits++
+			}
+		}
+		if strings.Join(gotA, "") != strings.Join(a, "") || strings.Join(gotB, "") != strings.Join(b, "") {
+			t.Fatalf("%q -> %q: invalid script", a, b)
+		}
+		if want := len(a) + len(b) - 2*lcs(a, b); edits != want {
+			t.Fatalf("%q -> %q: got %d edits, want %d", a, b, edits, want)
+		}
+	}
+}
+
+// lcs returns the length of the longest common subsequence of a and b.
+func lcs(a, b []string) int {
+	l := make([][]int, len(a)+1)
+	for i := range l {
+		l[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				l[i][j] = l[i+1][j+1] + 1
+			} else if l[i+1][j] > l[i][j+1] {
+				l[i][j] = l[i+1][j]
+			} else {
+				l[i][j] = l[i][j+1]
+			}
+		}
+	}
+	return l[0][0]
+}
+
+func TestEditDiff(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "sshd_config")
+	content := "Port 22\nPermitRootLogin yes\n"
+
+	if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// == Diff of the last change
+	e, err := NewEdit(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = e.Replace([]Replacer{{"yes", "no"}}); err != nil {
+		t.Fatal(err)
+	}
+	want := "--- " + name + "\n+++ " + name + "\n@@ -1,2 +1,2 @@\n Port 22\n-PermitRootLogin yes\n+PermitRootLogin no\n"
+	if e.Diff() != want {
+		t.Errorf("Diff: got %q, want %q", e.Diff(), want)
+	}
+	if err = e.Replace([]Replacer{{"foo", "bar"}}); err != nil {
+		t.Fatal(err)
+	}
+	if e.Diff() != "" {
+		t.Errorf("Diff: got %q without changes", e.Diff())
+	}
+	e.Close()
+
+	// == Log
+	buf := new(bytes.Buffer)
+	shout.SetLogHandler(shout.NewWriterHandler(buf))
+	defer shout.SetLogHandler(shout.DiscardHandler)
+	LOG_DIFF = true
+
+	err = OverwriteString(name, content)
+	LOG_DIFF = false
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "+PermitRootLogin yes") {
+		t.Errorf("log: got %q", buf)
+	}
+
+	// == Dry-run
+	buf.Reset()
+	DIFF_OUTPUT = buf
+	DRY_RUN = true
+	defer func() {
+		DRY_RUN = false
+		DIFF_OUTPUT = os.Stdout
+	}()
+
+	os.Remove(name + "+1~")
+	// The file does not need permission to write.
+	if err = os.Chmod(name, 0444); err != nil {
+		t.Fatal(err)
+	}
+	if e, err = NewEdit(name); err != nil {
+		t.Fatal(err)
+	}
+	if err = e.Replace([]Replacer{{"22", "2222"}}); err != nil {
+		t.Fatal(err)
+	}
+	// The next change is done over the previous one.
+	if err = e.AppendString("UseDNS no\n"); err != nil {
+		t.Fatal(err)
+	}
+	e.Close()
+	os.Chmod(name, 0644)
+
+	if err = OverwriteString(name, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if b, _ := os.ReadFile(name); string(b) != content {
+		t.Errorf("dry-run: the file was changed: %q", b)
+	}
+	if _, err = os.Stat(name + "+1~"); !os.IsNotExist(err) {
+		t.Error("dry-run: the file was backed up")
+	}
+	if e.dryName != "" {
+		if _, err = os.Stat(e.dryName); !os.IsNotExist(err) {
+			t.Error("dry-run: the temporary file was not removed")
+		}
+	}
+
+	out := buf.String()
+	for _, v := range []string{"-Port 22\n+Port 2222\n", " Port 2222\n PermitRootLogin yes\n+UseDNS no\n", "-PermitRootLogin yes\n"} {
+		if !strings.Contains(out, v) {
+			t.Errorf("dry-run: %q not found in\n%s", v, out)
+		}
+	}
+
+	// The file is written if DryRun is unset in the edit.
+	if e, err = NewEdit(name); err != nil {
+		t.Fatal(err)
+	}
+	e.DryRun, e.Atomic = false, false
+	if err = e.AppendString("UseDNS no\n"); err != nil {
+		t.Fatal(err)
+	}
+	e.Close()
+	if b, _ := os.ReadFile(name); string(b) != content+"UseDNS no\n" {
+		t.Errorf("DryRun unset: got %q", b)
+	}
+}
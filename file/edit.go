@@ -12,31 +12,66 @@
 // the advantage of that it is created automatically a backup before of editing
 // a file.
 //
+// The files are rewritten atomically: the new content is written to a temporary
+// file which is renamed over the original, so a crash or a full disk never
+// leaves a file half-written. It can be disabled with ATOMIC, or with the field
+// Atomic of an edit.
+//
+// The backups are made according to the policy in BACKUP, which can be
+// enabled or disabled, keeps up to a number of backups pruning the oldest ones,
+// and names them with a number (the newest one is "+1~") or with the time. They
+// can be saved into a directory which mirrors the path of the files. An edit
+// can use its own policy through NewEditBackup. The backups can be listed with
+// Backups, compared with DiffBackup, and restored with Restore; RestoreSince
+// rolls back all files changed since a time, i.e. after a script has failed.
+//
+// Every change can be got in unified format through the method Diff of an edit,
+// and logged setting LOG_DIFF. In dry-run mode, set through DRY_RUN, the diffs
+// are printed instead of writing the files.
+//
 package file
 
 import (
 	"bufio"
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"io"
 	"io/ioutil"
 	"os"
 	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/kless/shout"
 )
 
 // editDefault represents the vaues by default to set in type edit.
 type editDefault struct {
 	CommentChar string // character used in comments
-	//DoBackup    bool   // do backup before of edit?
+	Atomic      bool   // write to a temporary file renamed over the file; see ATOMIC
+	DryRun      bool   // print the diffs instead of writing; see DRY_RUN
+	LogDiff     bool   // log the diff of every change; see LOG_DIFF
 }
 
 // Values by default for type edit.
-var _editDefault = editDefault{"#"}
+var _editDefault = editDefault{CommentChar: "#"}
 
 // edit represents the file to edit.
 type edit struct {
 	editDefault
+	name string
 	file *os.File
 	buf  *bufio.ReadWriter
+
+	backup  string // name of the backup
+	sum     string // checksum of the content, to audit the changes
+	dryName string // temporary file with the changes, in dry-run mode
+	rdOnly  bool   // opened only to read, in dry-run mode
+
+	// == Last change
+	diff          string // got when it is needed
+	before, after []byte // contents to get the diff, if it is not got yet
 }
 
 type Replacer struct {
@@ -47,32 +82,76 @@ type ReplacerAtLine struct {
 	Line, Search, Replace string
 }
 
-// NewEdit opens a file to edit; it is created a backup.
+// NewEdit opens a file to edit; it is created a backup according to the policy
+// in BACKUP.
 func NewEdit(name string) (*edit, error) {
-	if err := Backup(name); err != nil {
-		return nil, err
+	return NewEditBackup(name, BACKUP)
+}
+
+// NewEditBackup opens a file to edit; it is created a backup according to the
+// policy p. In dry-run mode, there is not backup.
+func NewEditBackup(name string, p BackupPolicy) (*edit, error) {
+	var bakName string
+	var err error
+
+	if !DRY_RUN {
+		if bakName, err = p.backup(name); err != nil {
+			return nil, err
+		}
 	}
 
-	file, err := os.OpenFile(name, os.O_RDWR, 0666)
+	// In dry-run mode, the file is not written.
+	flag := os.O_RDWR
+	if DRY_RUN {
+		flag = os.O_RDONLY
+	}
+	file, err := os.OpenFile(name, flag, 0666)
 	if err != nil {
 		return nil, err
 	}
 
-	return &edit{
-		_editDefault,
-		file,
-		bufio.NewReadWriter(bufio.NewReader(file), bufio.NewWriter(file)),
-	}, nil
+	e := &edit{
+		editDefault: _editDefault,
+		name:        name,
+		file:        file,
+		buf:         bufio.NewReadWriter(bufio.NewReader(file), bufio.NewWriter(file)),
+		backup:      bakName,
+		rdOnly:      DRY_RUN,
+	}
+	e.Atomic = ATOMIC
+	e.DryRun = DRY_RUN
+	e.LogDiff = LOG_DIFF
+
+	if shout.Auditing() {
+		e.sum = checksum(name)
+	}
+	return e, nil
 }
 
 // Append writes len(b) bytes at the end of the File. It returns an error, if any.
 func (e *edit) Append(b []byte) error {
-	_, err := e.file.Seek(0, os.SEEK_END)
+	e.resetDiff()
+
+	content, err := e.read()
 	if err != nil {
 		return err
 	}
+	if e.Atomic || e.DryRun {
+		return e.rewrite("Append", append(content, b...))
+	}
+	e.setDiff("Append", content, append(content, b...))
+
+	if err = e.writable(); err != nil {
+		return err
+	}
+	if _, err = e.file.Seek(0, os.SEEK_END); err != nil {
+		return err
+	}
 
 	_, err = e.file.Write(b)
+	if shout.Auditing() {
+		e.audit("Append", checksum(e.name), err)
+	}
 	return err
 }
 
@@ -84,6 +163,9 @@ func (e *edit) AppendString(s string) error {
 
 // Close closes the file.
 func (e *edit) Close() error {
+	if e.dryName != "" {
+		defer os.Remove(e.dryName)
+	}
 	return e.file.Close()
 }
 
@@ -100,6 +182,7 @@ func (e *edit) Comment(reLine []string) error {
 		}
 	}
 
+	e.resetDiff()
 	if _, err := e.file.Seek(0, os.SEEK_SET); err != nil {
 		return err
 	}
@@ -132,7 +215,7 @@ func (e *edit) Comment(reLine []string) error {
 	}
 
 	if isNew {
-		return e.rewrite(buf.Bytes())
+		return e.rewrite("Comment", buf.Bytes())
 	}
 	return nil
 }
@@ -153,16 +236,72 @@ func (e *edit) CommentOut(reLine []string) error {
 	return e.ReplaceAtLineN(allSearch, 1)
 }
 
-/*// Insert writes len(b) bytes at the start of the File. It returns an error, if any.
-func (e *edit) Insert(b []byte) error {
-	return e.rewrite(b)
+// InsertAfter inserts text after of the first line that maches the regular
+// expression in reLine.
+func (e *edit) InsertAfter(reLine, text string) error {
+	return e.genInsert("InsertAfter", reLine, text, 1, true)
 }
 
-// InsertString is like Insert, but writes the contents of string s rather than
-// an array of bytes.
-func (e *edit) InsertString(s string) error {
-	return e.rewrite([]byte(s))
-}*/
+// InsertAfterN inserts text after of the lines that mach the regular expression
+// in reLine. The count determines the number to match:
+//   n > 0: at most n matches
+//   n == 0: the result is none
+//   n < 0: all matches
+func (e *edit) InsertAfterN(reLine, text string, n int) error {
+	return e.genInsert("InsertAfter", reLine, text, n, true)
+}
+
+// InsertBefore inserts text before of the first line that maches the regular
+// expression in reLine.
+func (e *edit) InsertBefore(reLine, text string) error {
+	return e.genInsert("InsertBefore", reLine, text, 1, false)
+}
+
+// InsertBeforeN inserts text before of the lines that mach the regular
+// expression in reLine. The count determines the number to match:
+//   n > 0: at most n matches
+//   n == 0: the result is none
+//   n < 0: all matches
+func (e *edit) InsertBeforeN(reLine, text string, n int) error {
+	return e.genInsert("InsertBefore", reLine, text, n, false)
+}
+
+// InsertAt inserts text at the line number, starting from 1, so its first line
+// gets that number. The number after of the last line appends it.
+func (e *edit) InsertAt(line int, text string) error {
+	e.resetDiff()
+
+	content, err := e.read()
+	if err != nil {
+		return err
+	}
+	lines := splitLines(content)
+
+	if line < 1 || line > len(lines)+1 {
+		return lineError(line)
+	}
+	eol := lineEnding(lines)
+
+	buf := new(bytes.Buffer)
+	for _, v := range lines[:line-1] {
+		buf.WriteString(v)
+	}
+	// The last line could have no line ending.
+	if line > 1 && !strings.HasSuffix(lines[line-2], "\n") {
+		buf.WriteString(eol)
+	}
+	buf.WriteString(textLines(text, eol))
+	for _, v := range lines[line-1:] {
+		buf.WriteString(v)
+	}
+
+	return e.rewrite("InsertAt", buf.Bytes())
+}
+
+// Prepend inserts text at the start of the file.
+func (e *edit) Prepend(text string) error {
+	return e.InsertAt(1, text)
+}
 
 // Replace replaces all regular expressions mathed in r.
 func (e *edit) Replace(r []Replacer) error {
@@ -196,14 +335,12 @@ func (e *edit) ReplaceAtLineN(r []ReplacerAtLine, n int) error {
 
 // Generic Replace: replaces a number of regular expressions matched in r.
 func (e *edit) genReplace(r []Replacer, n int) error {
+	e.resetDiff()
 	if n == 0 {
 		return nil
 	}
-	if _, err := e.file.Seek(0, os.SEEK_SET); err != nil {
-		return err
-	}
 
-	content, err := ioutil.ReadAll(e.buf)
+	content, err := e.read()
 	if err != nil {
 		return err
 	}
@@ -233,7 +370,7 @@ func (e *edit) genReplace(r []Replacer, n int) error {
 	}
 
 	if isNew {
-		return e.rewrite(content)
+		return e.rewrite("Replace", content)
 	}
 	return nil
 }
@@ -241,6 +378,7 @@ func (e *edit) genReplace(r []Replacer, n int) error {
 // Generic ReplaceAtLine: replaces a number of regular expressions matched in r,
 // if the line is matched at the first.
 func (e *edit) genReplaceAtLine(r []ReplacerAtLine, n int) error {
+	e.resetDiff()
 	if n == 0 {
 		return nil
 	}
@@ -302,12 +440,148 @@ func (e *edit) genReplaceAtLine(r []ReplacerAtLine, n int) error {
 	}
 
 	if isNew {
-		return e.rewrite(buf.Bytes())
+		return e.rewrite("ReplaceAtLine", buf.Bytes())
 	}
 	return nil
 }
 
-func (e *edit) rewrite(b []byte) error {
+// Generic Insert: inserts text before or after of a number of lines matched
+// by the regular expression in reLine.
+func (e *edit) genInsert(operation, reLine, text string, n int, after bool) error {
+	e.resetDiff()
+	if n == 0 {
+		return nil
+	}
+
+	re, err := regexp.Compile(reLine)
+	if err != nil {
+		return err
+	}
+	content, err := e.read()
+	if err != nil {
+		return err
+	}
+	lines := splitLines(content)
+	eol := lineEnding(lines)
+	insert := textLines(text, eol)
+
+	buf := new(bytes.Buffer)
+	isNew := false
+
+	for _, line := range lines {
+		match := n != 0 && re.MatchString(strings.TrimRight(line, "\r\n"))
+		if match {
+			n--
+			isNew = true
+		}
+
+		if match && !after {
+			buf.WriteString(insert)
+		}
+		buf.WriteString(line)
+		if match && after {
+			if !strings.HasSuffix(line, "\n") {
+				buf.WriteString(eol)
+			}
+			buf.WriteString(insert)
+		}
+	}
+
+	if isNew {
+		return e.rewrite(operation, buf.Bytes())
+	}
+	return nil
+}
+
+// Diff returns the changes done by the last operation, in unified format. It
+// is empty if the file was not changed.
+func (e *edit) Diff() string {
+	if e.before != nil || e.after != nil {
+		e.diff = Diff(e.name, e.name, e.before, e.after)
+		e.before, e.after = nil, nil
+	}
+	return e.diff
+}
+
+// resetDiff clears the diff of the last change.
+func (e *edit) resetDiff() {
+	e.diff, e.before, e.after = "", nil, nil
+}
+
+// read returns the content of the file.
+func (e *edit) read() ([]byte, error) {
+	if _, err := e.file.Seek(0, os.SEEK_SET); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(e.buf)
+}
+
+// setDiff records an operation which changes the content a by b. The diff is
+// only got if it is logged or printed, according to LogDiff and DryRun, or if
+// it is asked through Diff.
+func (e *edit) setDiff(operation string, a, b []byte) {
+	// The contents are never nil, so Diff knows that they are set.
+	if a == nil {
+		a = []byte{}
+	}
+	if b == nil {
+		b = []byte{}
+	}
+	e.diff, e.before, e.after = "", a, b
+
+	if e.DryRun || e.LogDiff {
+		showDiff(e.name, operation, e.Diff(), e.DryRun, e.LogDiff)
+	}
+}
+
+// rewrite replaces the content of the file by b, recording the operation in
+// the audit log. If Atomic is set, the file is replaced and opened again.
+//
+// In dry-run mode, the file is not written; the content is written to a
+// temporary file, which is used by the next operations.
+func (e *edit) rewrite(operation string, b []byte) (err error) {
+	old, err := e.read()
+	if err != nil {
+		return err
+	}
+	e.setDiff(operation, old, b)
+
+	if e.DryRun {
+		if e.dryName == "" {
+			tmp, err := ioutil.TempFile("", "shout-dryrun-")
+			if err != nil {
+				return err
+			}
+			e.dryName = tmp.Name()
+			tmp.Close()
+		}
+		if err = ioutil.WriteFile(e.dryName, b, 0600); err != nil {
+			return err
+		}
+		return e.open(e.dryName)
+	}
+
+	if shout.Auditing() {
+		defer func() {
+			if err == nil {
+				sum := sha256.Sum256(b)
+				e.audit(operation, hex.EncodeToString(sum[:]), nil)
+			} else {
+				e.audit(operation, checksum(e.name), err)
+			}
+		}()
+	}
+
+	if e.Atomic {
+		if err = writeFile(e.name, b, true); err != nil {
+			return err
+		}
+		return e.open(e.name)
+	}
+
+	if err = e.writable(); err != nil {
+		return err
+	}
 	if _, err := e.file.Seek(0, os.SEEK_SET); err != nil {
 		return err
 	}
@@ -319,7 +593,65 @@ func (e *edit) rewrite(b []byte) error {
 	if err = e.file.Truncate(int64(n)); err != nil {
 		return err
 	}
-	return nil // e.file.Sync()
+	return e.file.Sync()
+}
+
+// open opens the named file to be used in the next operations, after of being
+// replaced.
+func (e *edit) open(name string) error {
+	file, err := os.OpenFile(name, os.O_RDWR, 0666)
+	if err != nil {
+		return err
+	}
+
+	e.file.Close()
+	e.file = file
+	e.buf = bufio.NewReadWriter(bufio.NewReader(file), bufio.NewWriter(file))
+	e.rdOnly = false
+	return nil
+}
+
+// writable opens the file to write, if it was opened only to read because of
+// DRY_RUN, and the field DryRun was unset later.
+func (e *edit) writable() error {
+	if !e.rdOnly {
+		return nil
+	}
+	return e.open(e.name)
+}
+
+// audit records an operation in the audit log, being sum the checksum of the
+// new content.
+func (e *edit) audit(operation, sum string, err error) {
+	shout.AuditEdit(e.name, operation, e.backup, e.sum, sum, err)
+	e.sum = sum
+}
+
+// lineEnding returns the line ending used in lines, "\r\n" or "\n" by
+// default.
+func lineEnding(lines []string) string {
+	if len(lines) != 0 && strings.HasSuffix(lines[0], "\r\n") {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// textLines returns the lines of text ended by eol.
+func textLines(text, eol string) string {
+	text = strings.TrimSuffix(text, "\n")
+	text = strings.TrimSuffix(text, "\r")
+
+	lines := strings.Split(text, "\n")
+	for i, v := range lines {
+		lines[i] = strings.TrimSuffix(v, "\r")
+	}
+	return strings.Join(lines, eol) + eol
+}
+
+type lineError int
+
+func (e lineError) Error() string {
+	return "line " + strconv.Itoa(int(e)) + " out of range"
 }
 
 // * * *
@@ -378,23 +710,57 @@ func CommentOutM(name string, reLine []string) error {
 	return e.CommentOut(reLine)
 }
 
-/*// Insert writes len(b) bytes at the start of the named file. It returns an
-// error, if any. The file is backed up.
-func Insert(name string, b []byte) error {
+// InsertAfter inserts text after of the first line that maches the regular
+// expression in reLine, in the named file.
+func InsertAfter(name, reLine, text string) error {
+	return InsertAfterN(name, reLine, text, 1)
+}
+
+// InsertAfterN inserts text after of a number of lines that mach the regular
+// expression in reLine, in the named file.
+func InsertAfterN(name, reLine, text string, n int) error {
 	e, err := NewEdit(name)
 	if err != nil {
 		return err
 	}
 	defer e.Close()
 
-	return e.Insert(b)
+	return e.InsertAfterN(reLine, text, n)
 }
 
-// InsertString is like Insert, but writes the contents of string s rather than
-// an array of bytes.
-func InsertString(s, name string) error {
-	return Insert(name, []byte(s))
-}*/
+// InsertBefore inserts text before of the first line that maches the regular
+// expression in reLine, in the named file.
+func InsertBefore(name, reLine, text string) error {
+	return InsertBeforeN(name, reLine, text, 1)
+}
+
+// InsertBeforeN inserts text before of a number of lines that mach the regular
+// expression in reLine, in the named file.
+func InsertBeforeN(name, reLine, text string, n int) error {
+	e, err := NewEdit(name)
+	if err != nil {
+		return err
+	}
+	defer e.Close()
+
+	return e.InsertBeforeN(reLine, text, n)
+}
+
+// InsertAt inserts text at the line number in the named file.
+func InsertAt(name string, line int, text string) error {
+	e, err := NewEdit(name)
+	if err != nil {
+		return err
+	}
+	defer e.Close()
+
+	return e.InsertAt(line, text)
+}
+
+// Prepend inserts text at the start of the named file.
+func Prepend(name, text string) error {
+	return InsertAt(name, 1, text)
+}
 
 // Replace replaces all regular expressions mathed in r for the named file.
 func Replace(name string, r []Replacer) error {
@@ -65,15 +65,6 @@ func TestEdit(t *testing.T) {
 		}
 	}
 
-	/*// Insert
-	if err = e.InsertString(line); err != nil {
-		t.Error(err)
-	} else {
-		if out, _, _ := Run("head -n1 " + TEMP_FILE); out != line {
-			t.Errorf("Insert => got %q, want %q", out, line)
-		}
-	}*/
-
 	// Replace
 	repl := []Replacer{
 		{"dolor", "DOL_"},
@@ -154,3 +145,96 @@ func TestEdit(t *testing.T) {
 		}
 	}
 }
+
+func TestInsert(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "smb.conf")
+
+	tests := []struct {
+		in   string
+		fn   func(e *edit) error
+		want string
+	}{
+		{
+			"[global]\nworkgroup = HOME\n[homes]\n",
+			func(e *edit) error { return e.InsertAfter(`^\[.*\]$`, "; section") },
+			"[global]\n; section\nworkgroup = HOME\n[homes]\n",
+		},
+		{
+			"[global]\nworkgroup = HOME\n[homes]\n",
+			func(e *edit) error { return e.InsertAfterN(`^\[.*\]$`, "; section", -1) },
+			"[global]\n; section\nworkgroup = HOME\n[homes]\n; section\n",
+		},
+		{
+			"[global]\nworkgroup = HOME\n[homes]\n",
+			func(e *edit) error { return e.InsertBefore(`^\[homes\]`, "# users\n") },
+			"[global]\nworkgroup = HOME\n# users\n[homes]\n",
+		},
+		{
+			"a\nb\na\n",
+			func(e *edit) error { return e.InsertBeforeN("a", "x\ny", 2) },
+			"x\ny\na\nb\nx\ny\na\n",
+		},
+		{
+			"a\r\nb\r\n",
+			func(e *edit) error { return e.InsertAt(2, "x\ny") },
+			"a\r\nx\r\ny\r\nb\r\n",
+		},
+		{
+			"a\nb",
+			func(e *edit) error { return e.InsertAt(3, "c") },
+			"a\nb\nc\n",
+		},
+		{
+			"a\nb",
+			func(e *edit) error { return e.InsertAfter("b", "c") },
+			"a\nb\nc\n",
+		},
+		{
+			"a\n",
+			func(e *edit) error { return e.Prepend("#!/bin/sh") },
+			"#!/bin/sh\na\n",
+		},
+		{
+			"",
+			func(e *edit) error { return e.Prepend("a") },
+			"a\n",
+		},
+	}
+
+	for i, tt := range tests {
+		if err := os.WriteFile(name, []byte(tt.in), 0644); err != nil {
+			t.Fatal(err)
+		}
+		e, err := NewEdit(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = tt.fn(e)
+		e.Close()
+		if err != nil {
+			t.Errorf("#%d: %s", i, err)
+			continue
+		}
+
+		if b, _ := os.ReadFile(name); string(b) != tt.want {
+			t.Errorf("#%d: got %q, want %q", i, b, tt.want)
+		}
+	}
+
+	// == Package functions
+	if err := os.WriteFile(name, []byte("a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := InsertAt(name, 3, "c"); err == nil {
+		t.Error("InsertAt: expected error for a line out of range")
+	}
+	if err := Prepend(name, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := InsertAfter(name, "a", "c"); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(name); string(b) != "b\na\nc\n" {
+		t.Errorf("package functions: got %q", b)
+	}
+}
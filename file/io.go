@@ -7,63 +7,28 @@
 package file
 
 import (
-	"fmt"
+	"crypto/sha256"
+	"encoding/hex"
 	"io"
 	"os"
-	"path/filepath"
-)
-
-const _BACKUP_SUFFIX = "+[1-9]~" // suffix pattern added to backup's file name
-
-// Backup creates a backup of the named file.
-//
-// The schema used for the new name is: {name}\+[1-9]~
-//   name: The original file name.
-//   + : Character used to separate the file name from rest.
-//   number: A number from 1 to 9, using rotation.
-//   ~ : To indicate that it is a backup, just like it is used in Unix systems.
-func Backup(name string) error {
-	// Check if it is empty
-	info, err := os.Stat(name)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
-		return err
-	}
-	if info.Size() == 0 {
-		return nil
-	}
 
-	files, err := filepath.Glob(name + _BACKUP_SUFFIX)
-	if err != nil {
-		return err
-	}
-
-	// Number rotation
-	numBackup := byte(1)
-
-	if len(files) != 0 {
-		lastFile := files[len(files)-1]
-		numBackup = lastFile[len(lastFile)-2] + 1 // next number
-
-		if numBackup > '9' {
-			numBackup = '1'
-		}
-	} else {
-		numBackup = '1'
-	}
-
-	return Copy(name, fmt.Sprintf("%s+%s~", name, string(numBackup)))
-}
+	"github.com/kless/shout"
+)
 
 // Copy copies file in source to file in dest preserving the mode attributes.
-func Copy(source, dest string) error {
+func Copy(source, dest string) (err error) {
+	var bakName, before string
+
 	// Don't backup files of backup.
 	if dest[len(dest)-1] != '~' {
-		if err := Backup(dest); err != nil {
+		if bakName, err = backup(dest); err != nil {
 			return err
 		}
+
+		if shout.Auditing() {
+			before = checksum(dest)
+			defer func() { shout.AuditEdit(dest, "Copy", bakName, before, checksum(dest), err) }()
+		}
 	}
 
 	srcFile, err := os.Open(source)
@@ -87,16 +52,36 @@ func Copy(source, dest string) error {
 	return err
 }
 
-// Create creates a new file with b bytes.
-func Create(name string, b []byte) error {
-	file, err := os.Create(name)
-	if err != nil {
+// Create creates a new file with b bytes. If the file exists, it is replaced
+// atomically, unless ATOMIC is unset. In dry-run mode, the diff is printed
+// instead.
+func Create(name string, b []byte) (err error) {
+	if ok, err := mustWrite(name, "Create", b); !ok {
 		return err
 	}
-	defer file.Close()
 
-	_, err = file.Write(b)
-	return err
+	if shout.Auditing() {
+		before := checksum(name)
+		defer func() { shout.AuditEdit(name, "Create", "", before, checksum(name), err) }()
+	}
+
+	return writeFile(name, b, ATOMIC)
+}
+
+// checksum returns the SHA-256 of the named file, or an empty string if it can
+// not be read.
+func checksum(name string) string {
+	f, err := os.Open(name)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
 }
 
 // CreateString is like Create, but writes the contents of string s rather than
@@ -106,20 +91,24 @@ func CreateString(name, s string) error {
 }
 
 // Overwrite truncates the named file to zero and writes len(b) bytes. It
-// returns an error, if any.
-func Overwrite(name string, b []byte) error {
-	if err := Backup(name); err != nil {
+// returns an error, if any. The file is replaced atomically, unless ATOMIC is
+// unset. In dry-run mode, the diff is printed instead.
+func Overwrite(name string, b []byte) (err error) {
+	if ok, err := mustWrite(name, "Overwrite", b); !ok {
 		return err
 	}
 
-	f, err := os.Create(name)
+	bakName, err := backup(name)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
-	_, err = f.Write(b)
-	return err
+	if shout.Auditing() {
+		before := checksum(name)
+		defer func() { shout.AuditEdit(name, "Overwrite", bakName, before, checksum(name), err) }()
+	}
+
+	return writeFile(name, b, ATOMIC)
 }
 
 // OverwriteString is like Overwrite, but writes the contents of string s rather
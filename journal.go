@@ -0,0 +1,179 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package shout
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// JOURNAL_SOCKET is the socket of systemd-journald for the native protocol.
+var JOURNAL_SOCKET = "/run/systemd/journal/socket"
+
+// hasJournal reports whether the socket of the journal exists.
+func hasJournal() bool {
+	info, err := os.Stat(JOURNAL_SOCKET)
+	return err == nil && info.Mode()&os.ModeSocket != 0
+}
+
+// NewJournalHandler returns a backend which sends the records to the journal of
+// systemd, using the native protocol over the datagram socket JOURNAL_SOCKET.
+//
+// Every record is sent with the fields MESSAGE, PRIORITY and SYSLOG_IDENTIFIER,
+// which is the tag or the name of the program if it is empty. The attributes
+// are sent as fields in upper case with the prefix "SHOUT_", so the attribute
+// "exit_code" is got in the field SHOUT_EXIT_CODE.
+func NewJournalHandler(tag string) (*journalHandler, error) {
+	conn, err := net.DialUnix("unixgram", nil,
+		&net.UnixAddr{Name: JOURNAL_SOCKET, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+
+	if tag == "" {
+		tag = filepath.Base(os.Args[0])
+	}
+	return &journalHandler{
+		conn: conn,
+		mu:   new(sync.Mutex),
+		tag:  tag,
+	}, nil
+}
+
+// journalHandler is the backend of the journal of systemd.
+type journalHandler struct {
+	conn *net.UnixConn
+	mu   *sync.Mutex
+	tag  string
+
+	prefix string // from the groups
+	attrs  []byte // fields got from WithAttrs, already encoded
+}
+
+// Close closes the connection to the journal.
+func (h *journalHandler) Close() error {
+	return h.conn.Close()
+}
+
+func (h *journalHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= logLeveler{}.Level()
+}
+
+func (h *journalHandler) Handle(_ context.Context, r slog.Record) error {
+	buf := new(bytes.Buffer)
+
+	journalField(buf, "MESSAGE", r.Message)
+	journalField(buf, "PRIORITY", strconv.Itoa(journalPriority(r.Level)))
+	journalField(buf, "SYSLOG_IDENTIFIER", h.tag)
+	buf.Write(h.attrs)
+
+	r.Attrs(func(a slog.Attr) bool {
+		journalAttr(buf, h.prefix, a)
+		return true
+	})
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	_, err := h.conn.Write(buf.Bytes())
+	return err
+}
+
+func (h *journalHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	buf := bytes.NewBuffer(append([]byte(nil), h.attrs...))
+	for _, a := range attrs {
+		journalAttr(buf, h.prefix, a)
+	}
+
+	h2 := *h
+	h2.attrs = buf.Bytes()
+	return &h2
+}
+
+func (h *journalHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.prefix = h.prefix + name + "_"
+	return &h2
+}
+
+// journalPriority returns the priority of syslog for a level.
+func journalPriority(level slog.Level) int {
+	switch {
+	case level >= slog.LevelError:
+		return 3 // err
+	case level >= slog.LevelWarn:
+		return 4 // warning
+	case level >= slog.LevelInfo:
+		return 6 // info
+	}
+	return 7 // debug
+}
+
+// journalAttr encodes an attribute in buf, with the name of the field in upper
+// case and the prefix "SHOUT_".
+func journalAttr(buf *bytes.Buffer, prefix string, a slog.Attr) {
+	v := a.Value.Resolve()
+
+	if v.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "_"
+		}
+		for _, ga := range v.Group() {
+			journalAttr(buf, prefix, ga)
+		}
+		return
+	}
+	if a.Key == "" {
+		return
+	}
+	journalField(buf, journalName(prefix+a.Key), v.String())
+}
+
+// journalName returns a valid name of field: upper case letters, digits and
+// '_', with "SHOUT_" at the start.
+func journalName(key string) string {
+	name := []byte("SHOUT_")
+
+	for _, c := range []byte(strings.ToUpper(key)) {
+		if ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') {
+			name = append(name, c)
+		} else {
+			name = append(name, '_')
+		}
+	}
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return string(name)
+}
+
+// journalField encodes a field. The values with a new line are written with
+// its size in binary, as it is required by the protocol.
+func journalField(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name)
+
+	if strings.IndexByte(value, '\n') == -1 {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+	} else {
+		buf.WriteByte('\n')
+		binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+		buf.WriteString(value)
+	}
+	buf.WriteByte('\n')
+}
@@ -0,0 +1,98 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package shout
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+func TestJournal(t *testing.T) {
+	oldSocket, oldLog := JOURNAL_SOCKET, Log
+	defer func() { JOURNAL_SOCKET, Log = oldSocket, oldLog }()
+
+	JOURNAL_SOCKET = filepath.Join(t.TempDir(), "socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: JOURNAL_SOCKET, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if !hasJournal() {
+		t.Fatal("hasJournal: socket not found")
+	}
+	h, err := NewJournalHandler("shout_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	SetLogHandler(h)
+	Log.With("host", "h1").WithGroup("cmd").Warn("run failed",
+		"command", "false", "exit_code", 1, "stderr", "line1\nline2")
+
+	msg := make([]byte, 4096)
+	n, err := conn.Read(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields := parseJournal(t, msg[:n])
+	want := map[string]string{
+		"MESSAGE":             "run failed",
+		"PRIORITY":            "4",
+		"SYSLOG_IDENTIFIER":   "shout_test",
+		"SHOUT_HOST":          "h1",
+		"SHOUT_CMD_COMMAND":   "false",
+		"SHOUT_CMD_EXIT_CODE": "1",
+		"SHOUT_CMD_STDERR":    "line1\nline2",
+	}
+	for k, v := range want {
+		if fields[k] != v {
+			t.Errorf("field %s: got %q, want %q", k, fields[k], v)
+		}
+	}
+}
+
+// parseJournal decodes a message of the native protocol.
+func parseJournal(t *testing.T, msg []byte) map[string]string {
+	fields := make(map[string]string)
+
+	for len(msg) != 0 {
+		nl := bytes.IndexByte(msg, '\n')
+		if nl == -1 {
+			t.Fatalf("field without new line: %q", msg)
+		}
+		line := msg[:nl]
+
+		if eq := bytes.IndexByte(line, '='); eq != -1 {
+			fields[string(line[:eq])] = string(line[eq+1:])
+			msg = msg[nl+1:]
+			continue
+		}
+
+		size := binary.LittleEndian.Uint64(msg[nl+1 : nl+9])
+		fields[string(line)] = string(msg[nl+9 : nl+9+int(size)])
+		msg = msg[nl+9+int(size)+1:]
+	}
+	return fields
+}
+
+func TestJournalName(t *testing.T) {
+	for in, out := range map[string]string{
+		"exit_code": "SHOUT_EXIT_CODE",
+		"cmd.argv":  "SHOUT_CMD_ARGV",
+		"Dir":       "SHOUT_DIR",
+	} {
+		if got := journalName(in); got != out {
+			t.Errorf("journalName(%q): got %q, want %q", in, got, out)
+		}
+	}
+}
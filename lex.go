@@ -0,0 +1,480 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package shout
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+)
+
+// == Errors
+var (
+	errQuote       = errors.New("unexpected EOF while looking for matching quote")
+	errRedirect    = errors.New("no file name or delimiter after of redirection")
+	errRedirectIn  = errors.New("input redirection only allowed in the first command")
+	errRedirectOut = errors.New("output redirection only allowed in the last command")
+)
+
+type hereDocError string
+
+func (e hereDocError) Error() string {
+	return "here-document delimited by end-of-file (wanted `" + string(e) + "')"
+}
+
+// part is a piece of a word, and whether it was quoted.
+type part struct {
+	s       string
+	quoted  bool
+	dquoted bool // between double quotes, where the variables are expanded
+}
+
+// word represents an argument of the command line, split in parts according
+// to the quoting.
+type word []part
+
+// String returns the word without quotes.
+func (w word) String() string {
+	if len(w) == 1 {
+		return w[0].s
+	}
+	s := ""
+	for _, p := range w {
+		s += p.s
+	}
+	return s
+}
+
+// isQuoted reports whether any part of the word was quoted.
+func (w word) isQuoted() bool {
+	for _, p := range w {
+		if p.quoted {
+			return true
+		}
+	}
+	return false
+}
+
+// hereString returns the word as the body of a here-string, to be expanded like
+// a here-document: the characters '$' and '`' are escaped in the parts quoted
+// with single quotes or a backslash, and the backslash in every part.
+func (w word) hereString() string {
+	buf := new(bytes.Buffer)
+
+	for _, p := range w {
+		for i := 0; i < len(p.s); i++ {
+			switch c := p.s[i]; c {
+			case '$', '`':
+				if p.quoted && !p.dquoted {
+					buf.WriteByte('\\')
+				}
+			case '\\':
+				buf.WriteByte('\\')
+			}
+			buf.WriteByte(p.s[i])
+		}
+	}
+	buf.WriteByte('\n')
+	return buf.String()
+}
+
+// * * *
+
+type tokenType int
+
+const (
+	tokWord      tokenType = iota
+	tokPipe                // |
+	tokLess                // <
+	tokGreat               // >
+	tokDGreat              // >>
+	tokDLess               // <<
+	tokDLessDash           // <<-
+	tokTLess               // <<<
+)
+
+// token is a word or an operator. The here-documents get the body in the token
+// of the operator.
+type token struct {
+	typ    tokenType
+	word   word
+	body   string // here-document
+	expand bool   // has the here-document to expand variables?
+}
+
+// lexer splits a command line in tokens, following the quoting rules of the
+// shell.
+type lexer struct {
+	input   string
+	pos     int
+	tokens  []token
+	pending []int // tokens of here-documents waiting for its body
+
+	comments bool                    // skip from '#' until the end of line
+	lookup   func(key string) string // to expand variables, if it is not nil
+}
+
+// lex returns the tokens found in input.
+func lex(input string) ([]token, error) {
+	return (&lexer{input: input}).lex()
+}
+
+// lex returns the tokens found in the input of the lexer.
+func (l *lexer) lex() ([]token, error) {
+	for l.pos < len(l.input) {
+		switch c := l.input[l.pos]; {
+		case c == ' ' || c == '\t':
+			l.pos++
+		case c == '#' && l.comments:
+			if end := strings.IndexByte(l.input[l.pos:], '\n'); end != -1 {
+				l.pos += end
+			} else {
+				l.pos = len(l.input)
+			}
+		case c == '\n':
+			l.pos++
+			if err := l.readHereDocs(); err != nil {
+				return nil, err
+			}
+		case c == '|':
+			l.emit(tokPipe, 1)
+		case c == '<':
+			switch rest := l.input[l.pos:]; {
+			case strings.HasPrefix(rest, "<<<"):
+				l.emit(tokTLess, 3)
+			case strings.HasPrefix(rest, "<<-"):
+				l.pending = append(l.pending, len(l.tokens))
+				l.emit(tokDLessDash, 3)
+			case strings.HasPrefix(rest, "<<"):
+				l.pending = append(l.pending, len(l.tokens))
+				l.emit(tokDLess, 2)
+			default:
+				l.emit(tokLess, 1)
+			}
+		case c == '>':
+			if strings.HasPrefix(l.input[l.pos:], ">>") {
+				l.emit(tokDGreat, 2)
+			} else {
+				l.emit(tokGreat, 1)
+			}
+		default:
+			w, err := l.readWord()
+			if err != nil {
+				return nil, err
+			}
+			if w != nil {
+				l.tokens = append(l.tokens, token{typ: tokWord, word: w})
+			}
+		}
+	}
+
+	// Here-documents without a new line after of the command.
+	if len(l.pending) != 0 {
+		if err := l.readHereDocs(); err != nil {
+			return nil, err
+		}
+	}
+	return l.tokens, nil
+}
+
+// emit adds an operator of size n.
+func (l *lexer) emit(t tokenType, n int) {
+	l.tokens = append(l.tokens, token{typ: t})
+	l.pos += n
+}
+
+// readWord reads a word until a blank or an operator not quoted. It returns
+// nil if there is a line continuation without a word.
+func (l *lexer) readWord() (word, error) {
+	var (
+		w       word
+		unquote []byte // characters not quoted
+	)
+
+	// addUnquoted moves the characters not quoted to a new part.
+	addUnquoted := func() {
+		if len(unquote) != 0 {
+			w = append(w, part{string(unquote), false, false})
+			unquote = unquote[:0]
+		}
+	}
+
+L:
+	for l.pos < len(l.input) {
+		c := l.input[l.pos]
+
+		switch c {
+		case ' ', '\t', '\n', '|', '<', '>':
+			break L
+
+		case '\\':
+			l.pos++
+			if l.pos == len(l.input) {
+				unquote = append(unquote, c)
+				break L
+			}
+			if l.input[l.pos] == '\n' { // line continuation
+				l.pos++
+				continue
+			}
+			addUnquoted()
+			w = append(w, part{l.input[l.pos : l.pos+1], true, false})
+			l.pos++
+
+		case '\'':
+			end := strings.IndexByte(l.input[l.pos+1:], '\'')
+			if end == -1 {
+				return nil, errQuote
+			}
+			addUnquoted()
+			w = append(w, part{l.input[l.pos+1 : l.pos+1+end], true, false})
+			l.pos += end + 2
+
+		case '"':
+			parts, err := l.readDoubleQuote()
+			if err != nil {
+				return nil, err
+			}
+			addUnquoted()
+			w = append(w, parts...)
+
+		case '$':
+			if l.lookup != nil {
+				if v, ok := l.readVar(); ok {
+					unquote = append(unquote, v...)
+					continue
+				}
+			}
+			unquote = append(unquote, c)
+			l.pos++
+
+		default:
+			unquote = append(unquote, c)
+			l.pos++
+		}
+	}
+
+	addUnquoted()
+	return w, nil
+}
+
+// readDoubleQuote reads a string between double quotes, where the backslash
+// only quotes the characters '$', '`', '"', '\' or a new line. The characters
+// quoted by the backslash are returned in their own parts.
+func (l *lexer) readDoubleQuote() ([]part, error) {
+	var (
+		parts []part
+		s     []byte
+	)
+
+	for l.pos++; l.pos < len(l.input); l.pos++ {
+		c := l.input[l.pos]
+
+		switch c {
+		case '"':
+			l.pos++
+			if len(s) != 0 || len(parts) == 0 {
+				parts = append(parts, part{string(s), true, true})
+			}
+			return parts, nil
+		case '$':
+			if l.lookup != nil {
+				if v, ok := l.readVar(); ok {
+					s = append(s, v...)
+					l.pos-- // the loop goes to the next character
+					continue
+				}
+			}
+		case '\\':
+			if l.pos+1 < len(l.input) {
+				switch next := l.input[l.pos+1]; next {
+				case '$', '`', '"', '\\':
+					if len(s) != 0 {
+						parts = append(parts, part{string(s), true, true})
+						s = s[:0]
+					}
+					parts = append(parts, part{string(next), true, false})
+					l.pos++
+					continue
+				case '\n':
+					l.pos++
+					continue
+				}
+			}
+		}
+		s = append(s, c)
+	}
+	return nil, errQuote
+}
+
+// readVar reads a reference to a variable at the current position, $VAR or
+// ${VAR}, and returns its value. It returns false if there is not a name after
+// of '$', which is then a literal character.
+func (l *lexer) readVar() (string, bool) {
+	rest := l.input[l.pos+1:]
+
+	if strings.HasPrefix(rest, "{") {
+		end := strings.IndexByte(rest, '}')
+		if end == -1 || !isName(rest[1:end]) {
+			return "", false
+		}
+		l.pos += end + 2
+		return l.lookup(rest[1:end]), true
+	}
+
+	n := nameLen(rest)
+	if n == 0 {
+		return "", false
+	}
+	l.pos += n + 1
+	return l.lookup(rest[:n]), true
+}
+
+// readHereDocs reads the body of the pending here-documents, from the current
+// position until the line with the delimiter.
+func (l *lexer) readHereDocs() error {
+	for _, idx := range l.pending {
+		if idx+1 == len(l.tokens) || l.tokens[idx+1].typ != tokWord {
+			return errRedirect
+		}
+
+		delim := l.tokens[idx+1].word
+		stripTabs := l.tokens[idx].typ == tokDLessDash
+		body := make([]byte, 0, 64)
+		found := false
+
+		for l.pos < len(l.input) {
+			end := strings.IndexByte(l.input[l.pos:], '\n')
+			if end == -1 {
+				end = len(l.input)
+			} else {
+				end += l.pos
+			}
+
+			line := l.input[l.pos:end]
+			l.pos = end + 1
+
+			if stripTabs {
+				line = strings.TrimLeft(line, "\t")
+			}
+			if line == delim.String() {
+				found = true
+				break
+			}
+			body = append(body, line...)
+			body = append(body, '\n')
+		}
+
+		if !found {
+			return hereDocError(delim.String())
+		}
+		l.tokens[idx].body = string(body)
+		l.tokens[idx].expand = !delim.isQuoted()
+	}
+
+	l.pending = l.pending[:0]
+	return nil
+}
+
+// * * *
+
+// hereDoc represents the text to pass to the standard input of a command.
+type hereDoc struct {
+	body   string
+	expand bool // to expand variables
+}
+
+// stage represents a command of a pipeline.
+type stage struct {
+	env  []word // variables given before of the command
+	args []word
+
+	in        string   // file to read, from "<"
+	hereDoc   *hereDoc // from "<<", "<<-" or "<<<"
+	out       string   // file to write, from ">" or ">>"
+	appendOut bool
+}
+
+// parse splits the command line in the commands of a pipeline.
+func parse(command string) ([]*stage, error) {
+	tokens, err := lex(command)
+	if err != nil {
+		return nil, err
+	}
+
+	stages := []*stage{new(stage)}
+
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		st := stages[len(stages)-1]
+
+		switch t.typ {
+		case tokWord:
+			st.args = append(st.args, t.word)
+			continue
+		case tokPipe:
+			stages = append(stages, new(stage))
+			continue
+		}
+
+		// == Redirections
+		if i+1 == len(tokens) || tokens[i+1].typ != tokWord {
+			return nil, errRedirect
+		}
+		i++
+		name := tokens[i].word.String()
+
+		switch t.typ {
+		case tokLess:
+			st.in, st.hereDoc = name, nil
+		case tokDLess, tokDLessDash:
+			st.in, st.hereDoc = "", &hereDoc{t.body, t.expand}
+		case tokTLess:
+			st.in, st.hereDoc = "", &hereDoc{tokens[i].word.hereString(), true}
+		case tokGreat, tokDGreat:
+			st.out, st.appendOut = name, t.typ == tokDGreat
+		}
+	}
+
+	lastIdx := len(stages) - 1
+
+	for i, st := range stages {
+		if len(st.args) == 0 {
+			return nil, errNoCmdInPipe
+		}
+		if i != 0 && (st.in != "" || st.hereDoc != nil) {
+			return nil, errRedirectIn
+		}
+		if i != lastIdx && st.out != "" {
+			return nil, errRedirectOut
+		}
+
+		// == Get environment variables in the first arguments, if any.
+		for len(st.args) != 0 {
+			w := st.args[0]
+
+			if w[0].quoted || strings.IndexByte(w[0].s, '=') < 1 {
+				if len(st.args) > 1 && !st.args[1][0].quoted &&
+					strings.HasPrefix(st.args[1][0].s, "=") { // VAR =foo
+					return nil, errEnvVar
+				}
+				break
+			}
+			if last := w[len(w)-1]; !last.quoted && strings.HasSuffix(last.s, "=") { // VAR= foo
+				return nil, errEnvVar
+			}
+
+			st.env = append(st.env, w)
+			st.args = st.args[1:]
+		}
+		if len(st.args) == 0 {
+			return nil, errNoCmdInPipe
+		}
+	}
+
+	return stages, nil
+}
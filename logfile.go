@@ -0,0 +1,289 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package shout
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	_LOG_FILE     = "shout.log" // in LOG_DIR
+	_ROTATE_RETRY = time.Minute // time to wait to rotate again after of an error
+)
+
+var (
+	LOG_DIR     = "/var/log/shout" // directory of the log files; see Installer
+	LOG_TO_FILE bool               // log to LOG_DIR instead of the system log; always in boot
+)
+
+// logFileDefault represents the values by default to set in type logFile.
+type logFileDefault struct {
+	MaxSize  int64         // size in bytes to rotate the file; 0 to disable
+	MaxAge   time.Duration // time since it was opened to rotate the file; 0 to disable
+	Compress bool          // compress the rotated files with gzip
+	Keep     int           // number of rotated files to keep; 0 to keep all
+}
+
+var _logFileDefault = logFileDefault{MaxSize: 10 << 20, Keep: 5}
+
+// logFile represents a log file which is rotated.
+type logFile struct {
+	logFileDefault
+
+	name   string
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+	hup    chan os.Signal
+
+	rotateAt time.Time // to rotate again after of an error; zero if it did not fail
+}
+
+// NewLogFile opens the log file name, in LOG_DIR if it is not an absolute path,
+// to append. The file is rotated by size (MaxSize) or by time (MaxAge), and it
+// is reopened when the process gets the signal SIGHUP, so it can be rotated by
+// an external program like logrotate.
+//
+// The rotated files are named with a number: "name.1" is the most recent one,
+// and "name.1.gz" if they are compressed.
+func NewLogFile(name string) (*logFile, error) {
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(LOG_DIR, name)
+	}
+
+	lf := &logFile{logFileDefault: _logFileDefault, name: name}
+	if err := lf.open(); err != nil {
+		return nil, err
+	}
+
+	lf.hup = make(chan os.Signal, 1)
+	signal.Notify(lf.hup, syscall.SIGHUP)
+	go func() {
+		for range lf.hup {
+			if err := lf.Reopen(); err != nil {
+				Log.Error("log file not reopened", "file", lf.name, "error", err)
+			}
+		}
+	}()
+
+	return lf, nil
+}
+
+// open opens the file to append.
+func (lf *logFile) open() error {
+	f, err := os.OpenFile(lf.name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	lf.file, lf.size, lf.opened = f, info.Size(), time.Now()
+	return nil
+}
+
+// Write writes b to the file, rotating it before if it is needed. If the
+// rotation fails, b is written to the same file, the error is reported to the
+// standard error, and the rotation is not tried again until _ROTATE_RETRY.
+func (lf *logFile) Write(b []byte) (int, error) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+
+	if lf.file == nil {
+		return 0, os.ErrClosed
+	}
+	if ((lf.MaxSize > 0 && lf.size > 0 && lf.size+int64(len(b)) > lf.MaxSize) ||
+		(lf.MaxAge > 0 && time.Since(lf.opened) >= lf.MaxAge)) &&
+		!time.Now().Before(lf.rotateAt) {
+		if err := lf.rotate(); err != nil {
+			// It can not be logged since it would be written to this file.
+			if lf.rotateAt.IsZero() {
+				fmt.Fprintf(os.Stderr, "[Shout] log file %q not rotated: %s\n", lf.name, err)
+			}
+			lf.rotateAt = time.Now().Add(_ROTATE_RETRY)
+		}
+	}
+
+	n, err := lf.file.Write(b)
+	lf.size += int64(n)
+	return n, err
+}
+
+// Reopen closes and opens the file, which could have been moved.
+func (lf *logFile) Reopen() error {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+
+	if lf.file == nil {
+		return os.ErrClosed
+	}
+	if err := lf.file.Close(); err != nil {
+		return err
+	}
+	return lf.open()
+}
+
+// Rotate rotates the file.
+func (lf *logFile) Rotate() error {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+
+	if lf.file == nil {
+		return os.ErrClosed
+	}
+	return lf.rotate()
+}
+
+// Close closes the file.
+func (lf *logFile) Close() error {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+
+	if lf.file == nil {
+		return nil
+	}
+	signal.Stop(lf.hup)
+	close(lf.hup)
+
+	err := lf.file.Close()
+	lf.file = nil
+	return err
+}
+
+// rotate moves every rotated file to the next number, removing the ones which
+// are not kept, and opens a new file with the same owner. If the rotation
+// fails, the file is opened again to keep on logging.
+func (lf *logFile) rotate() error {
+	info, err := lf.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	err = lf.file.Close()
+	if err == nil {
+		err = lf.shift()
+	}
+	if err != nil {
+		if e := lf.open(); e != nil {
+			return e
+		}
+		return err
+	}
+
+	if err = lf.open(); err != nil {
+		return err
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		lf.file.Chown(int(st.Uid), int(st.Gid))
+	}
+	lf.rotateAt = time.Time{}
+	return nil
+}
+
+// shift moves the old files to the next number, and the current one to the
+// number 1, compressing it if Compress is set.
+func (lf *logFile) shift() error {
+	last := 0
+	for lf.Keep == 0 || last < lf.Keep {
+		if lf.rotated(last+1) == "" {
+			break
+		}
+		last++
+	}
+	if lf.Keep != 0 && last == lf.Keep {
+		if err := os.Remove(lf.rotated(last)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		last--
+	}
+	for i := last; i > 0; i-- {
+		old := lf.rotated(i)
+		if err := os.Rename(old, lf.rotatedName(i+1, filepath.Ext(old) == ".gz")); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Rename(lf.name, lf.rotatedName(1, false)); err != nil {
+		return err
+	}
+	if lf.Compress {
+		return compressFile(lf.rotatedName(1, false))
+	}
+	return nil
+}
+
+// rotatedName returns the name of the rotated file number i.
+func (lf *logFile) rotatedName(i int, compressed bool) string {
+	name := lf.name + "." + strconv.Itoa(i)
+	if compressed {
+		name += ".gz"
+	}
+	return name
+}
+
+// rotated returns the name of the rotated file number i which exists, or an
+// empty string.
+func (lf *logFile) rotated(i int) string {
+	for _, compressed := range []bool{false, true} {
+		name := lf.rotatedName(i, compressed)
+		if _, err := os.Lstat(name); err == nil {
+			return name
+		}
+	}
+	return ""
+}
+
+// compressFile compresses the file name to "name.gz", removing the original.
+func compressFile(name string) (err error) {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(name+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if e := dst.Close(); e != nil && err == nil {
+			err = e
+		}
+		if err != nil {
+			os.Remove(name + ".gz")
+		}
+	}()
+
+	zw := gzip.NewWriter(dst)
+	if _, err = io.Copy(zw, src); err != nil {
+		return err
+	}
+	if err = zw.Close(); err != nil {
+		return err
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		dst.Chown(int(st.Uid), int(st.Gid))
+	}
+	return os.Remove(name)
+}
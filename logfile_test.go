@@ -0,0 +1,139 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package shout
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestLogFile(t *testing.T) {
+	oldDir := LOG_DIR
+	LOG_DIR = t.TempDir()
+	defer func() { LOG_DIR = oldDir }()
+
+	lf, err := NewLogFile("test.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lf.Close()
+
+	name := filepath.Join(LOG_DIR, "test.log")
+	lf.MaxSize, lf.Keep = 10, 2
+
+	// == Rotation by size
+	for _, s := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err = lf.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for file, want := range map[string]string{
+		name:        "fourth\n",
+		name + ".1": "third\n",
+		name + ".2": "second\n",
+	} {
+		if got := readLogFile(t, file); got != want {
+			t.Errorf("%s: got %q, want %q", file, got, want)
+		}
+	}
+	if _, err = os.Stat(name + ".3"); !os.IsNotExist(err) {
+		t.Errorf("retention: file %q not removed", name+".3")
+	}
+
+	// == Compression
+	lf.Compress = true
+	if err = lf.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readLogFile(t, name+".1.gz"); got != "fourth\n" {
+		t.Errorf("compress: got %q", got)
+	}
+	if got := readLogFile(t, name+".2"); got != "third\n" {
+		t.Errorf("compress: got %q in file .2", got)
+	}
+
+	// == Rotation by time
+	lf.MaxSize, lf.MaxAge = 0, time.Nanosecond
+	lf.Write([]byte("fifth\n"))
+	if got := readLogFile(t, name+".1.gz"); got != "" {
+		t.Errorf("time: got %q, want the empty file rotated", got)
+	}
+	lf.MaxAge = 0
+
+	// == Reopen on SIGHUP
+	if err = os.Rename(name, name+".moved"); err != nil {
+		t.Fatal(err)
+	}
+	syscall.Kill(os.Getpid(), syscall.SIGHUP)
+
+	for i := 0; i < 100; i++ {
+		if _, err = os.Stat(name); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	lf.Write([]byte("sixth\n"))
+
+	if got := readLogFile(t, name); got != "sixth\n" {
+		t.Errorf("SIGHUP: got %q", got)
+	}
+
+	// == Reopen if the rotation fails
+	// The file can not be renamed over a directory which is not empty.
+	if err = os.MkdirAll(filepath.Join(name+".1", "x"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	lf.Keep, lf.Compress = 1, false
+
+	if err = lf.Rotate(); err == nil {
+		t.Error("rotation failed: expected error")
+	}
+	if _, err = lf.Write([]byte("seventh\n")); err != nil {
+		t.Errorf("rotation failed: %s", err)
+	}
+
+	// The rotation by size fails, but the lines are written.
+	lf.MaxSize = 10
+	for _, s := range []string{"eighth\n", "ninth\n"} {
+		if _, err = lf.Write([]byte(s)); err != nil {
+			t.Errorf("rotation by size failed: %s", err)
+		}
+	}
+	if lf.rotateAt.IsZero() {
+		t.Error("rotation by size failed: rotation not delayed")
+	}
+	if got := readLogFile(t, name); got != "sixth\nseventh\neighth\nninth\n" {
+		t.Errorf("rotation failed: got %q", got)
+	}
+}
+
+// readLogFile returns the content of a log file, uncompressed if it has the
+// extension ".gz".
+func readLogFile(t *testing.T, name string) string {
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if filepath.Ext(name) == ".gz" {
+		if r, err = gzip.NewReader(f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
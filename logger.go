@@ -0,0 +1,239 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package shout
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"log/syslog"
+	"os"
+	"sync"
+)
+
+// LogLevel is the minimum level of the records to log, or slog.LevelDebug if
+// DEBUG is set.
+var LogLevel = new(slog.LevelVar)
+
+// logLeveler returns the level to log, according to LogLevel and DEBUG.
+type logLeveler struct{}
+
+func (logLeveler) Level() slog.Level {
+	if DEBUG {
+		return slog.LevelDebug
+	}
+	return LogLevel.Level()
+}
+
+// SetLogHandler sets Log to write to the backend in h, masking the secrets.
+func SetLogHandler(h slog.Handler) {
+	Log = slog.New(redactHandler{h})
+}
+
+// * * *
+
+// == Backends
+
+// DiscardHandler is a backend which discards all records.
+var DiscardHandler slog.Handler = discardHandler{}
+
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// NewWriterHandler returns a backend which writes the records in text format,
+// "key=value", to w.
+func NewWriterHandler(w io.Writer) slog.Handler {
+	return slog.NewTextHandler(w, &slog.HandlerOptions{Level: logLeveler{}})
+}
+
+// NewStderrHandler returns a backend which writes to the standard error.
+func NewStderrHandler() slog.Handler {
+	return NewWriterHandler(os.Stderr)
+}
+
+// NewSyslogHandler returns a backend which writes to the system log, with the
+// priority got from the level of every record.
+func NewSyslogHandler(tag string) (slog.Handler, error) {
+	w, err := syslog.New(syslog.LOG_NOTICE|syslog.LOG_USER, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	lw := &levelWriter{w: w}
+	return &syslogHandler{
+		slog.NewTextHandler(lw, &slog.HandlerOptions{
+			Level: logLeveler{},
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				// The system log adds the time and the priority.
+				if len(groups) == 0 && (a.Key == slog.TimeKey || a.Key == slog.LevelKey) {
+					return slog.Attr{}
+				}
+				return a
+			},
+		}),
+		lw,
+	}, nil
+}
+
+type syslogHandler struct {
+	slog.Handler
+	w *levelWriter
+}
+
+func (h *syslogHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.w.mu.Lock()
+	defer h.w.mu.Unlock()
+
+	h.w.level = r.Level
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &syslogHandler{h.Handler.WithAttrs(attrs), h.w}
+}
+
+func (h *syslogHandler) WithGroup(name string) slog.Handler {
+	return &syslogHandler{h.Handler.WithGroup(name), h.w}
+}
+
+// levelWriter writes to the system log with the priority of the record being
+// handled.
+type levelWriter struct {
+	mu    sync.Mutex
+	w     *syslog.Writer
+	level slog.Level
+}
+
+func (lw *levelWriter) Write(b []byte) (int, error) {
+	s := string(b)
+
+	switch {
+	case lw.level >= slog.LevelError:
+		return len(b), lw.w.Err(s)
+	case lw.level >= slog.LevelWarn:
+		return len(b), lw.w.Warning(s)
+	case lw.level >= slog.LevelInfo:
+		return len(b), lw.w.Info(s)
+	}
+	return len(b), lw.w.Debug(s)
+}
+
+// * * *
+
+// redactHandler masks the secrets in the message and the attributes.
+type redactHandler struct {
+	slog.Handler
+}
+
+func (h redactHandler) Handle(ctx context.Context, r slog.Record) error {
+	newRecord := slog.NewRecord(r.Time, r.Level, Redact(r.Message), r.PC)
+
+	r.Attrs(func(a slog.Attr) bool {
+		newRecord.AddAttrs(redactAttr(a))
+		return true
+	})
+	return h.Handler.Handle(ctx, newRecord)
+}
+
+func (h redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	newAttrs := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		newAttrs[i] = redactAttr(a)
+	}
+	return redactHandler{h.Handler.WithAttrs(newAttrs)}
+}
+
+func (h redactHandler) WithGroup(name string) slog.Handler {
+	return redactHandler{h.Handler.WithGroup(name)}
+}
+
+// redactAttr masks the secrets in the value of an attribute.
+func redactAttr(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, Redact(v.String()))
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok {
+			return slog.String(a.Key, Redact(err.Error()))
+		}
+		return slog.String(a.Key, Redact(fmt.Sprint(v.Any())))
+	case slog.KindGroup:
+		attrs := v.Group()
+		newAttrs := make([]interface{}, len(attrs))
+		for i, ga := range attrs {
+			newAttrs[i] = redactAttr(ga)
+		}
+		return slog.Group(a.Key, newAttrs...)
+	}
+	return a
+}
+
+// * * *
+
+var logCloser io.Closer // file or socket opened by StartLogger
+
+// StartLogger initializes the log, and the audit log if AUDIT_FILE is set.
+//
+// The log is written to the file _LOG_FILE in LOG_DIR, rotated, in boot or if
+// LOG_TO_FILE is set; else to the journal of systemd if its socket
+// JOURNAL_SOCKET exists, or to the system log. If it can not be used, the log
+// is written to the standard error.
+func StartLogger() {
+	var (
+		h   slog.Handler
+		err error
+	)
+
+	if Booting() || LOG_TO_FILE {
+		var lf *logFile
+		if lf, err = NewLogFile(_LOG_FILE); err == nil {
+			h, logCloser = NewWriterHandler(lf), lf
+		}
+	} else {
+		if hasJournal() {
+			var jh *journalHandler
+			if jh, err = NewJournalHandler(""); err == nil {
+				h, logCloser = jh, jh
+			}
+		}
+		if h == nil {
+			h, err = NewSyslogHandler("")
+		}
+	}
+
+	if err != nil {
+		SetLogHandler(NewStderrHandler())
+		Log.Warn("log written to standard error", "error", err)
+	} else {
+		SetLogHandler(h)
+	}
+
+	if err = startAudit(); err != nil {
+		Log.Error("audit log not started", "error", err)
+	}
+}
+
+// CloseLogger closes the log file and the audit log.
+func CloseLogger() error {
+	err := closeAudit()
+
+	if logCloser != nil {
+		if e := logCloser.Close(); e != nil {
+			err = e
+		}
+		logCloser = nil
+	}
+	SetLogHandler(DiscardHandler)
+	return err
+}
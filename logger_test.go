@@ -0,0 +1,54 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package shout
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+	buf := new(bytes.Buffer)
+
+	oldLog, oldDebug, oldLevel := Log, DEBUG, LogLevel.Level()
+	SetLogHandler(NewWriterHandler(buf))
+	defer func() {
+		Log, DEBUG = oldLog, oldDebug
+		LogLevel.Set(oldLevel)
+	}()
+
+	// == Levels
+	DEBUG = false
+	LogLevel.Set(slog.LevelWarn)
+	Log.Info("hidden")
+	Log.Warn("shown")
+
+	if out := buf.String(); strings.Contains(out, "hidden") || !strings.Contains(out, "level=WARN msg=shown") {
+		t.Errorf("level Warn: got %q", out)
+	}
+
+	buf.Reset()
+	DEBUG = true
+	Log.Debug("debug")
+
+	if out := buf.String(); !strings.Contains(out, "level=DEBUG msg=debug") {
+		t.Errorf("DEBUG: got %q", out)
+	}
+
+	// == Secrets
+	buf.Reset()
+	AddSecret("s3cr3t_log")
+	Log.Error("login s3cr3t_log", "pass", "s3cr3t_log", "error", errors.New("bad s3cr3t_log"),
+		slog.Group("g", "args", []string{"-p", "s3cr3t_log"}))
+
+	if out := buf.String(); strings.Contains(out, "s3cr3t_log") {
+		t.Errorf("secret not masked: %q", out)
+	}
+}
@@ -21,6 +21,8 @@ package packager
 import (
 	"errors"
 	"os/exec"
+
+	"github.com/kless/shout"
 )
 
 type Packager interface {
@@ -53,19 +55,34 @@ const (
 	ZYpp
 )
 
+var packageTypeNames = [...]string{
+	Deb:    "deb",
+	RPM:    "rpm",
+	Pacman: "pacman",
+	Ebuild: "ebuild",
+	ZYpp:   "zypp",
+}
+
+func (p PackageType) String() string {
+	if p < Deb || int(p) >= len(packageTypeNames) {
+		return "unknown"
+	}
+	return packageTypeNames[p]
+}
+
 // New returns the interface to handle the package manager.
 func New(p PackageType) Packager {
 	switch p {
 	case Deb:
-		return new(deb)
+		return auditPackager{p, new(deb)}
 	case RPM:
-		return new(rpm)
+		return auditPackager{p, new(rpm)}
 	case Pacman:
-		return new(pacman)
+		return auditPackager{p, new(pacman)}
 	case Ebuild:
-		return new(ebuild)
+		return auditPackager{p, new(ebuild)}
 	case ZYpp:
-		return new(zypp)
+		return auditPackager{p, new(zypp)}
 	}
 	panic("unreachable")
 }
@@ -92,7 +109,7 @@ func Detect() (PackageType, Packager, error) {
 	for k, v := range execPackagers {
 		_, err := exec.LookPath("/usr/bin/" + k)
 		if err == nil {
-			return v.typ, v.pkg, nil
+			return v.typ, auditPackager{v.typ, v.pkg}, nil
 		}
 	}
 	return 0, nil, errors.New("package manager not found in directory /usr/bin")
@@ -100,14 +117,52 @@ func Detect() (PackageType, Packager, error) {
 
 // * * *
 
-// runc executes a command logging its output if there is not any error.
+// auditPackager records the operations of a package manager in the audit log.
+type auditPackager struct {
+	typ PackageType
+	pkg Packager
+}
+
+func (a auditPackager) Install(name ...string) error {
+	err := a.pkg.Install(name...)
+	shout.AuditPackages(a.typ.String(), "install", name, err)
+	return err
+}
+
+func (a auditPackager) Remove(isMetapackage bool, name ...string) error {
+	err := a.pkg.Remove(isMetapackage, name...)
+	shout.AuditPackages(a.typ.String(), "remove", name, err)
+	return err
+}
+
+func (a auditPackager) Purge(isMetapackage bool, name ...string) error {
+	err := a.pkg.Purge(isMetapackage, name...)
+	shout.AuditPackages(a.typ.String(), "purge", name, err)
+	return err
+}
+
+func (a auditPackager) Clean() error {
+	err := a.pkg.Clean()
+	shout.AuditPackages(a.typ.String(), "clean", nil, err)
+	return err
+}
+
+func (a auditPackager) Upgrade() error {
+	err := a.pkg.Upgrade()
+	shout.AuditPackages(a.typ.String(), "upgrade", nil, err)
+	return err
+}
+
+// * * *
+
+// run executes a command logging its output if there is not any error.
 func run(cmd string, arg ...string) error {
-	_, err := exec.Command(cmd, arg...).CombinedOutput()
+	out, err := exec.Command(cmd, arg...).CombinedOutput()
 	if err != nil {
 		return err
 	}
 
-	// log.Print(string(out)) // DEBUG
+	shout.Log.Debug(cmd, "args", arg, "output", string(out))
 	return nil
 }
 
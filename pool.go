@@ -0,0 +1,183 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package shout
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+)
+
+var errNotRun = errors.New("command not run due to a previous error")
+
+// Result represents the result of a command line run by a pool.
+type Result struct {
+	Command string
+	Output  []byte
+	Ok      bool
+	Err     error
+}
+
+// pool represents a pool of workers to run command lines concurrently.
+type pool struct {
+	cmdDefault // configuration of every command
+
+	MaxProcs    int       // maximum number of commands run at the same time
+	StopOnError bool      // don't start more commands after of the first error
+	Output      io.Writer // to write the output of every command while it is run
+}
+
+// NewPool returns a pool to run at most maxProcs commands at the same time or,
+// if it is lesser than 1, as many as CPUs.
+//
+// The commands have not standard input, and their output is written to the
+// field Output, if it is not nil, with every line prefixed by the position of
+// the command, i.e. "[0] ", so the lines of several commands are not mixed.
+// The commands are retried according to the field Retry, unless Output is set.
+func NewPool(maxProcs int) *pool {
+	if maxProcs < 1 {
+		maxProcs = runtime.NumCPU()
+	}
+	return &pool{cmdDefault: _cmdDefault, MaxProcs: maxProcs}
+}
+
+// Run runs the command lines, returning their results in the same order.
+func (p *pool) Run(lines ...string) []Result {
+	ch := make(chan string)
+
+	go func() {
+		for _, v := range lines {
+			ch <- v
+		}
+		close(ch)
+	}()
+	return p.RunChan(ch)
+}
+
+// RunChan runs the command lines got from the channel until it is closed,
+// returning their results in the same order. If StopOnError is set, the
+// commands got after of an error are not run, and their result has the error
+// errNotRun.
+func (p *pool) RunChan(lines <-chan string) []Result {
+	var (
+		results []Result
+		failed  bool
+		mu      sync.Mutex // protects results and failed
+		outMu   sync.Mutex // protects Output
+		wg      sync.WaitGroup
+	)
+	sem := make(chan struct{}, p.MaxProcs)
+
+	for line := range lines {
+		sem <- struct{}{}
+
+		mu.Lock()
+		i := len(results)
+		results = append(results, Result{Command: line})
+
+		if failed && p.StopOnError {
+			results[i].Err = errNotRun
+			mu.Unlock()
+			<-sem
+			continue
+		}
+		mu.Unlock()
+
+		wg.Add(1)
+		go func(i int, line string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			cmd := &command{cmdDefault: p.cmdDefault, line: line, noStdin: true}
+
+			var out *prefixWriter
+			if p.Output != nil {
+				out = &prefixWriter{mu: &outMu, w: p.Output, prefix: fmt.Sprintf("[%d] ", i)}
+				cmd.Stdout = out
+			}
+
+			output, ok, err := cmd.Run()
+			if out != nil {
+				out.Flush()
+			}
+
+			mu.Lock()
+			results[i].Output, results[i].Ok, results[i].Err = output, ok, err
+			if err != nil {
+				failed = true
+			}
+			mu.Unlock()
+		}(i, line)
+	}
+
+	wg.Wait()
+	return results
+}
+
+// RunAll runs the command lines with at most maxProcs at the same time, as in
+// NewPool. It returns the results in the same order, and the first error
+// found in them, if any.
+func RunAll(maxProcs int, lines ...string) ([]Result, error) {
+	results := NewPool(maxProcs).Run(lines...)
+
+	for _, r := range results {
+		if r.Err != nil {
+			return results, r.Err
+		}
+	}
+	return results, nil
+}
+
+// * * *
+
+// prefixWriter writes every line with a prefix. The lines are written complete
+// so several writers can share the same output.
+type prefixWriter struct {
+	mu     *sync.Mutex // shared by all writers to w
+	w      io.Writer
+	prefix string
+	buf    []byte // incomplete line
+}
+
+func (pw *prefixWriter) Write(b []byte) (int, error) {
+	pw.buf = append(pw.buf, b...)
+
+	for {
+		i := bytes.IndexByte(pw.buf, '\n')
+		if i == -1 {
+			break
+		}
+		if err := pw.writeLine(pw.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		pw.buf = pw.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+// Flush writes the last line, if it was not ended with a new line.
+func (pw *prefixWriter) Flush() error {
+	if len(pw.buf) == 0 {
+		return nil
+	}
+	err := pw.writeLine(append(pw.buf, '\n'))
+	pw.buf = nil
+	return err
+}
+
+func (pw *prefixWriter) writeLine(line []byte) error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	_, err := pw.w.Write(append([]byte(pw.prefix), line...))
+	return err
+}
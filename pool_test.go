@@ -0,0 +1,80 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package shout
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunAll(t *testing.T) {
+	lines := []string{"sh -c 'sleep 0.2; echo 0'", "echo 1", "sh -c 'sleep 0.1; echo 2'", "echo 3"}
+
+	start := time.Now()
+	results, err := RunAll(4, lines...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 300*time.Millisecond {
+		t.Errorf("commands not run concurrently: %s", d)
+	}
+
+	for i, r := range results {
+		if r.Command != lines[i] {
+			t.Errorf("result %d => command got %q, want %q", i, r.Command, lines[i])
+		}
+		if want := string('0'+byte(i)) + "\n"; string(r.Output) != want {
+			t.Errorf("result %d => output got %q, want %q", i, r.Output, want)
+		}
+	}
+
+	// == Errors
+	p := NewPool(1)
+	p.StopOnError = true
+
+	results = p.Run("echo 0", "nocommand_shout", "echo 2")
+	if results[0].Err != nil || results[1].Err == nil || results[2].Err != errNotRun {
+		t.Errorf("StopOnError => got errors %v, %v, %v",
+			results[0].Err, results[1].Err, results[2].Err)
+	}
+
+	// == Retry
+	attempts := 0
+	p = NewPool(1)
+	p.Retry = Retry{Attempts: 3, Delay: time.Millisecond,
+		Retryable: func(exitCode int, stderr []byte) bool {
+			attempts++
+			return true
+		},
+	}
+
+	if results = p.Run("sh -c 'echo failed >&2; exit 1'"); results[0].Err == nil || attempts != 2 {
+		t.Errorf("Retry => error %v, attempts %d", results[0].Err, attempts)
+	}
+
+	// == Output with prefix
+	out := new(bytes.Buffer)
+	p = NewPool(2)
+	p.Output = out
+
+	ch := make(chan string)
+	go func() {
+		ch <- "printf 'a\\nb'"
+		ch <- "echo c"
+		close(ch)
+	}()
+	p.RunChan(ch)
+
+	got := strings.Split(strings.TrimSpace(out.String()), "\n")
+	sort.Strings(got)
+	if want := "[0] a,[0] b,[1] c"; strings.Join(got, ",") != want {
+		t.Errorf("output => got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// +build linux
+
+package prompt
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// ASK_PASSWORD_DIR is the directory where the questions are written for the
+// password agents of systemd.
+var ASK_PASSWORD_DIR = "/run/systemd/ask-password"
+
+// ErrCanceled reports a question canceled by the password agent.
+var ErrCanceled = errors.New("the question was canceled by the password agent")
+
+// HasAgent reports whether the directory of the password agents exists.
+func HasAgent() bool {
+	info, err := os.Stat(ASK_PASSWORD_DIR)
+	return err == nil && info.IsDir()
+}
+
+// agentDefault represents the values by default to set in type agent.
+type agentDefault struct {
+	Timeout      time.Duration // time to wait for the answer; 0 to wait forever
+	AcceptCached bool          // can the agent answer with a cached password?
+	Icon         string        // name of the icon to show, if any
+}
+
+var _agentDefault = agentDefault{Timeout: 90 * time.Second}
+
+// agent asks the questions through the password agents of systemd, like
+// systemd-ask-password.
+type agent struct {
+	agentDefault
+	dir string
+}
+
+// NewAgent returns a backend which writes the questions in files "ask.*" in
+// dir, to be answered by any password agent, i.e.
+// systemd-tty-ask-password-agent; the answer is got through a datagram socket
+// created in dir.
+func NewAgent(dir string) *agent {
+	return &agent{agentDefault: _agentDefault, dir: dir}
+}
+
+func (a *agent) Ask(question string) (string, error) {
+	b, err := a.ask(question, true)
+	return string(b), err
+}
+
+func (a *agent) AskPassword(question string) ([]byte, error) {
+	return a.ask(question, false)
+}
+
+// Message does nothing, since the agents only answer questions.
+func (a *agent) Message(text string) error { return nil }
+
+// ask writes the question, and waits for the answer.
+func (a *agent) ask(question string, echo bool) ([]byte, error) {
+	id, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+
+	// == Socket to get the answer
+	sockName := filepath.Join(a.dir, "sck."+id)
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: sockName, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(sockName)
+	defer conn.Close()
+
+	if err = setPassCred(conn); err != nil {
+		return nil, err
+	}
+
+	// == Question
+	notAfter := uint64(0)
+	if a.Timeout > 0 {
+		notAfter = monotonicUsec() + uint64(a.Timeout/time.Microsecond)
+		conn.SetReadDeadline(time.Now().Add(a.Timeout))
+	}
+
+	content := fmt.Sprintf("[Ask]\nPID=%d\nSocket=%s\nAcceptCached=%d\nEcho=%d\nNotAfter=%d\nMessage=%s\n",
+		os.Getpid(), sockName, boolToInt(a.AcceptCached), boolToInt(echo), notAfter,
+		strings.Replace(strings.TrimSpace(question), "\n", " ", -1))
+	if a.Icon != "" {
+		content += "Icon=" + a.Icon + "\n"
+	}
+
+	// The agents watch the files moved into the directory, so it is written
+	// in a temporary file.
+	askName := filepath.Join(a.dir, "ask."+id)
+	tmpName := filepath.Join(a.dir, ".tmp."+id)
+
+	if err = os.WriteFile(tmpName, []byte(content), 0644); err != nil {
+		return nil, err
+	}
+	if err = os.Rename(tmpName, askName); err != nil {
+		os.Remove(tmpName)
+		return nil, err
+	}
+	defer os.Remove(askName)
+
+	// == Answer
+	buf := make([]byte, 64*1024)
+	oob := make([]byte, syscall.CmsgSpace(syscall.SizeofUcred))
+
+	for {
+		n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+		if err != nil {
+			return nil, fmt.Errorf("no answer from the password agent: %s", err)
+		}
+		// Only the answers from root or the same user are accepted.
+		if !trustedSender(oob[:oobn]) || n == 0 {
+			continue
+		}
+
+		switch buf[0] {
+		case '+':
+			return append([]byte(nil), buf[1:n]...), nil
+		case '-':
+			return nil, ErrCanceled
+		}
+	}
+}
+
+// setPassCred enables the receiving of the credentials of the sender.
+func setPassCred(conn *net.UnixConn) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_PASSCRED, 1)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
+
+// trustedSender reports whether the credentials in the control message are of
+// root or of the current user.
+func trustedSender(oob []byte) bool {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return false
+	}
+
+	for _, m := range msgs {
+		if cred, err := syscall.ParseUnixCredentials(&m); err == nil {
+			return cred.Uid == 0 || int(cred.Uid) == os.Getuid()
+		}
+	}
+	return false
+}
+
+// monotonicUsec returns the time of the monotonic clock in microseconds, used
+// by systemd in NotAfter.
+func monotonicUsec() uint64 {
+	var ts syscall.Timespec
+	syscall.Syscall(syscall.SYS_CLOCK_GETTIME, 1, // CLOCK_MONOTONIC
+		uintptr(unsafe.Pointer(&ts)), 0)
+	return uint64(ts.Sec)*1e6 + uint64(ts.Nsec)/1e3
+}
+
+// randomID returns a random name for the files of a question.
+func randomID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,99 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// +build linux
+
+package prompt
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeAgent answers the first question written in dir, returning its fields.
+func fakeAgent(t *testing.T, dir, reply string) <-chan map[string]string {
+	ch := make(chan map[string]string, 1)
+
+	go func() {
+		defer close(ch)
+
+		for i := 0; i < 200; i++ {
+			names, _ := filepath.Glob(filepath.Join(dir, "ask.*"))
+			if len(names) == 0 {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+
+			f, err := os.Open(names[0])
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			fields := make(map[string]string)
+			scan := bufio.NewScanner(f)
+			for scan.Scan() {
+				if kv := strings.SplitN(scan.Text(), "=", 2); len(kv) == 2 {
+					fields[kv[0]] = kv[1]
+				}
+			}
+			f.Close()
+
+			conn, err := net.Dial("unixgram", fields["Socket"])
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			conn.Write([]byte(reply))
+			conn.Close()
+
+			ch <- fields
+			return
+		}
+		t.Error("fake agent: no question found")
+	}()
+	return ch
+}
+
+func TestAgent(t *testing.T) {
+	dir := t.TempDir()
+	a := NewAgent(dir)
+	a.Timeout = 5 * time.Second
+
+	ch := fakeAgent(t, dir, "+s3cr3t")
+	pass, err := a.AskPassword("Password for disk:")
+	if err != nil || string(pass) != "s3cr3t" {
+		t.Errorf("AskPassword: got %q (%v)", pass, err)
+	}
+
+	fields := <-ch
+	if fields["Message"] != "Password for disk:" || fields["Echo"] != "0" ||
+		fields["NotAfter"] == "0" || fields["PID"] == "" {
+		t.Errorf("question: got %v", fields)
+	}
+
+	// The files are removed after of the answer.
+	if names, _ := filepath.Glob(filepath.Join(dir, "*")); len(names) != 0 {
+		t.Errorf("files not removed: %v", names)
+	}
+
+	ch = fakeAgent(t, dir, "-")
+	if _, err = a.Ask("Name:"); err != ErrCanceled {
+		t.Errorf("canceled: got error %v", err)
+	}
+	if fields = <-ch; fields["Echo"] != "1" {
+		t.Errorf("Ask: got Echo=%s", fields["Echo"])
+	}
+
+	a.Timeout = 50 * time.Millisecond
+	if _, err = a.AskPassword("Password:"); err == nil {
+		t.Error("timeout: expected error")
+	}
+}
@@ -0,0 +1,234 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package prompt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// _ANSWER_ENV is the prefix of the environment variables with answers.
+const _ANSWER_ENV = "SHOUT_ANSWER_"
+
+var (
+	answersMu   sync.RWMutex
+	answers     = make(map[string]string) // from LoadAnswers and SetAnswer
+	missingKeys []string                  // questions without answer
+)
+
+// answersFileError reports an error in a line of a file of answers.
+type answersFileError struct {
+	name string
+	line int
+	msg  string
+}
+
+func (e answersFileError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.name, e.line, e.msg)
+}
+
+// LoadAnswers loads the answers of the questions from the named files, in
+// format INI or JSON (if the extension is ".json" or the content starts with
+// '{'), like a preseed file of debconf.
+//
+// In INI format, the keys in a section are prefixed by its name and a dot:
+//
+//	hostname = box
+//	[disk]
+//	root = /dev/sda1   ; the key is "disk.root"
+//
+// In JSON, the objects are used like the sections.
+func LoadAnswers(names ...string) error {
+	for _, name := range names {
+		b, err := ioutil.ReadFile(name)
+		if err != nil {
+			return err
+		}
+
+		var m map[string]string
+		if filepath.Ext(name) == ".json" || bytes.HasPrefix(bytes.TrimSpace(b), []byte("{")) {
+			m, err = parseAnswersJSON(b)
+		} else {
+			m, err = parseAnswersINI(name, b)
+		}
+		if err != nil {
+			return err
+		}
+
+		answersMu.Lock()
+		for k, v := range m {
+			answers[k] = v
+		}
+		answersMu.Unlock()
+	}
+	return nil
+}
+
+// SetAnswer sets the answer for the question with the key.
+func SetAnswer(key, value string) {
+	answersMu.Lock()
+	answers[key] = value
+	answersMu.Unlock()
+}
+
+// preseed returns the answer for the key, from the environment variable
+// SHOUT_ANSWER_<KEY> or else from the loaded answers.
+func preseed(key string) (string, bool) {
+	if key == "" {
+		return "", false
+	}
+	if v, ok := os.LookupEnv(AnswerEnv(key)); ok {
+		return v, true
+	}
+
+	answersMu.RLock()
+	defer answersMu.RUnlock()
+	v, ok := answers[key]
+	return v, ok
+}
+
+// AnswerEnv returns the name of the environment variable with the answer for
+// the key: SHOUT_ANSWER_ and the key in upper case, where the characters which
+// are not letters or digits are replaced by '_'; i.e. "disk.root" is got from
+// SHOUT_ANSWER_DISK_ROOT.
+func AnswerEnv(key string) string {
+	name := []byte(_ANSWER_ENV)
+
+	for _, c := range []byte(strings.ToUpper(key)) {
+		if ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') {
+			name = append(name, c)
+		} else {
+			name = append(name, '_')
+		}
+	}
+	return string(name)
+}
+
+// Require checks that there is an answer for every key in non-interactive mode,
+// so the missing ones are reported before of asking anything.
+func Require(keys ...string) error {
+	if getBackend() != NonInteractive {
+		return nil
+	}
+
+	var err MissingError
+	for _, k := range keys {
+		if _, ok := preseed(k); !ok {
+			err = append(err, k)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// missing records the key of a question without answer, returning the error
+// with all keys recorded. The question is used if there is not a key.
+func missing(key, question string) MissingError {
+	if key == "" {
+		key = strconv.Quote(question)
+	}
+
+	answersMu.Lock()
+	defer answersMu.Unlock()
+
+	if i := sort.SearchStrings(missingKeys, key); i == len(missingKeys) || missingKeys[i] != key {
+		missingKeys = append(missingKeys, "")
+		copy(missingKeys[i+1:], missingKeys[i:])
+		missingKeys[i] = key
+	}
+	return append(MissingError{}, missingKeys...)
+}
+
+// * * *
+
+// parseAnswersINI parses the answers in format INI.
+func parseAnswersINI(name string, b []byte) (map[string]string, error) {
+	m := make(map[string]string)
+	section := ""
+
+	scan := bufio.NewScanner(bytes.NewReader(b))
+	for nLine := 1; scan.Scan(); nLine++ {
+		line := strings.TrimSpace(scan.Text())
+
+		switch {
+		case line == "" || line[0] == '#' || line[0] == ';':
+			continue
+		case line[0] == '[':
+			if !strings.HasSuffix(line, "]") {
+				return nil, answersFileError{name, nLine, "section without ']'"}
+			}
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+
+		i := strings.IndexByte(line, '=')
+		if i < 1 {
+			return nil, answersFileError{name, nLine, "expected key = value"}
+		}
+		key := strings.TrimSpace(line[:i])
+		value := strings.TrimSpace(line[i+1:])
+
+		if len(value) > 1 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		} else if j := strings.Index(value, " ;"); j != -1 { // comment
+			value = strings.TrimSpace(value[:j])
+		} else if j = strings.Index(value, " #"); j != -1 {
+			value = strings.TrimSpace(value[:j])
+		}
+
+		if section != "" {
+			key = section + "." + key
+		}
+		m[key] = value
+	}
+	return m, scan.Err()
+}
+
+// parseAnswersJSON parses the answers in format JSON, where the values can be
+// strings, numbers, booleans or objects.
+func parseAnswersJSON(b []byte) (map[string]string, error) {
+	var v map[string]interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]string)
+	return m, flattenJSON(m, "", v)
+}
+
+func flattenJSON(m map[string]string, prefix string, obj map[string]interface{}) error {
+	for k, v := range obj {
+		key := prefix + k
+
+		switch v := v.(type) {
+		case string:
+			m[key] = v
+		case bool:
+			m[key] = strconv.FormatBool(v)
+		case float64:
+			m[key] = strconv.FormatFloat(v, 'f', -1, 64)
+		case map[string]interface{}:
+			if err := flattenJSON(m, key+".", v); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("answer for %s: value of type %T", key, v)
+		}
+	}
+	return nil
+}
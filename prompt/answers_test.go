@@ -0,0 +1,76 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package prompt
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAnswers(t *testing.T) {
+	dir := t.TempDir()
+	ini := filepath.Join(dir, "answers.ini")
+	js := filepath.Join(dir, "answers.json")
+
+	os.WriteFile(ini, []byte(`# Preseed
+hostname = box   ; the name
+[disk]
+root = "/dev/sda1"
+format = yes
+`), 0644)
+	os.WriteFile(js, []byte(`{"user": {"name": "jonas", "admin": true}, "disk.fs": "ext4"}`), 0644)
+
+	if err := LoadAnswers(ini, js); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("SHOUT_ANSWER_USER_PASSWORD", "s3cr3t")
+	defer os.Unsetenv("SHOUT_ANSWER_USER_PASSWORD")
+
+	SetBackend(NonInteractive)
+	defer func() {
+		SetBackend(nil)
+		answers, missingKeys = make(map[string]string), nil
+	}()
+
+	if v, err := Ask("hostname", "Host name", "", nil); err != nil || v != "box" {
+		t.Errorf("Ask from INI: got %q (%v)", v, err)
+	}
+	if v, err := Ask("user.name", "User", "", nil); err != nil || v != "jonas" {
+		t.Errorf("Ask from JSON: got %q (%v)", v, err)
+	}
+	if ok, err := Confirm("disk.format", "Format", false); err != nil || !ok {
+		t.Errorf("Confirm from INI: got %v (%v)", ok, err)
+	}
+	if ok, err := Confirm("user.admin", "Admin", false); err != nil || !ok {
+		t.Errorf("Confirm from JSON: got %v (%v)", ok, err)
+	}
+	if i, err := Select("disk.fs", "File system", []string{"ext3", "ext4"}, 0); err != nil || i != 1 {
+		t.Errorf("Select by text: got %d (%v)", i, err)
+	}
+	if pass, err := PasswordConfirm("user.password", "Password", "Again"); err != nil || string(pass) != "s3cr3t" {
+		t.Errorf("Password from environment: got %q (%v)", pass, err)
+	}
+
+	SetAnswer("disk.swap", "no-number")
+	if _, err := Select("disk.swap", "Swap", []string{"sda2"}, -1); err == nil {
+		t.Error("Select with answer not valid: expected error")
+	}
+
+	// == Missing keys
+	err := Require("hostname", "net.ip", "disk.boot")
+	if want := (MissingError{"net.ip", "disk.boot"}); !reflect.DeepEqual(err, want) {
+		t.Errorf("Require: got %v, want %v", err, want)
+	}
+
+	Ask("net.ip", "IP", "", nil)
+	_, err = Password("disk.boot", "Password")
+	if wantKeys := (MissingError{"disk.boot", "net.ip"}); !reflect.DeepEqual(err, wantKeys) {
+		t.Errorf("missing keys: got %v, want %v", err, wantKeys)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package prompt
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// PLYMOUTH is the program to communicate with Plymouth, during the graphical
+// boot.
+var PLYMOUTH = "/bin/plymouth"
+
+// == Terminal
+
+// terminal asks the questions in a terminal, or in any reader and writer.
+type terminal struct {
+	mu sync.Mutex
+	fd int // of the input, to turn off the echo; -1 if it is not a terminal
+	r  *bufio.Reader
+	w  io.Writer
+}
+
+// NewTerminal returns a backend which writes the questions to w and reads the
+// answers from r. The echo is turned off to read passwords if r is a terminal.
+func NewTerminal(r io.Reader, w io.Writer) *terminal {
+	fd := -1
+	if f, ok := r.(*os.File); ok && IsTerminal(int(f.Fd())) {
+		fd = int(f.Fd())
+	}
+	return &terminal{fd: fd, r: bufio.NewReader(r), w: w}
+}
+
+func (t *terminal) Ask(question string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, err := io.WriteString(t.w, question); err != nil {
+		return "", err
+	}
+	line, err := t.readLine()
+	return string(line), err
+}
+
+func (t *terminal) AskPassword(question string) (pass []byte, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, err = io.WriteString(t.w, question); err != nil {
+		return nil, err
+	}
+
+	if t.fd != -1 {
+		restore, e := echoOff(t.fd)
+		if e != nil {
+			return nil, e
+		}
+		defer func() {
+			restore()
+			io.WriteString(t.w, "\n") // the one not shown
+		}()
+	}
+	return t.readLine()
+}
+
+func (t *terminal) Message(text string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	_, err := io.WriteString(t.w, text+"\n")
+	return err
+}
+
+// readLine reads a line without the new line, with any size.
+func (t *terminal) readLine() ([]byte, error) {
+	line, err := t.r.ReadBytes('\n')
+	if err == io.EOF && len(line) != 0 {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(line, "\r\n"), nil
+}
+
+// == Plymouth
+
+// plymouth asks the questions through Plymouth.
+type plymouth struct {
+	cmd string
+}
+
+// NewPlymouth returns a backend which uses the program cmd of Plymouth.
+func NewPlymouth(cmd string) *plymouth {
+	return &plymouth{cmd}
+}
+
+// Running reports whether the daemon of Plymouth is running.
+func (p *plymouth) Running() bool {
+	if _, err := os.Stat(p.cmd); err != nil {
+		return false
+	}
+	return exec.Command(p.cmd, "--ping").Run() == nil
+}
+
+func (p *plymouth) Ask(question string) (string, error) {
+	out, err := p.run("ask-question", "--prompt="+question)
+	return strings.TrimRight(string(out), "\n"), err
+}
+
+func (p *plymouth) AskPassword(question string) ([]byte, error) {
+	out, err := p.run("ask-for-password", "--prompt="+question)
+	return bytes.TrimRight(out, "\n"), err
+}
+
+func (p *plymouth) Message(text string) error {
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		if _, err := p.run("display-message", "--text="+line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *plymouth) run(arg ...string) ([]byte, error) {
+	out, err := exec.Command(p.cmd, arg...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("plymouth %s: %s", arg[0], err)
+	}
+	return out, nil
+}
+
+// == Non-interactive
+
+// NonInteractive is the backend which does not ask, so the default values are
+// used, or else it is returned an error.
+var NonInteractive Backend = nonInteractive{}
+
+type nonInteractive struct{}
+
+func (nonInteractive) Ask(string) (string, error)         { return "", ErrNonInteractive }
+func (nonInteractive) AskPassword(string) ([]byte, error) { return nil, ErrNonInteractive }
+func (nonInteractive) Message(string) error               { return nil }
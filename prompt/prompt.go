@@ -0,0 +1,286 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// Package prompt asks questions to the user.
+//
+// The questions are asked through a backend: the terminal, Plymouth during the
+// graphical boot, the password agents of systemd (see NewAgent), or none in
+// non-interactive mode, where the default value is used if there is one, else
+// it is returned an error. The backend is chosen the first time it is needed,
+// unless it is set with SetBackend.
+//
+// Every question has a key to be answered without asking, like the preseeding
+// of debconf: from the environment variable SHOUT_ANSWER_<KEY> (see AnswerEnv),
+// or from a file of answers loaded with LoadAnswers. In non-interactive mode,
+// the questions without answer nor default value fail with a MissingError,
+// which lists the keys of all missing answers.
+//
+package prompt
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// == Errors
+var (
+	ErrNonInteractive = errors.New("no input in non-interactive mode")
+	ErrMismatch       = errors.New("the passwords do not match")
+	ErrEmpty          = errors.New("empty answer")
+)
+
+// MissingError reports the keys of the questions without answer in
+// non-interactive mode.
+type MissingError []string
+
+func (e MissingError) Error() string {
+	return "no answers in non-interactive mode for: " + strings.Join(e, ", ")
+}
+
+// MAX_TRIES is the number of times that a question is asked while the answer
+// is not valid.
+var MAX_TRIES = 3
+
+// Backend represents a way to ask the questions.
+type Backend interface {
+	// Ask shows the question and returns the line written by the user.
+	Ask(question string) (string, error)
+
+	// AskPassword is like Ask, but the input is not shown.
+	AskPassword(question string) ([]byte, error)
+
+	// Message shows a message.
+	Message(text string) error
+}
+
+var (
+	backendMu sync.Mutex
+	backend   Backend
+)
+
+// SetBackend sets the backend to ask the questions.
+func SetBackend(b Backend) {
+	backendMu.Lock()
+	backend = b
+	backendMu.Unlock()
+}
+
+// getBackend returns the backend, choosing it if it is not set: Plymouth if it
+// is running, the terminal if the standard input is a terminal, or else the
+// non-interactive mode.
+func getBackend() Backend {
+	backendMu.Lock()
+	defer backendMu.Unlock()
+
+	if backend == nil {
+		if p := NewPlymouth(PLYMOUTH); p.Running() {
+			backend = p
+		} else if IsTerminal(int(os.Stdin.Fd())) {
+			backend = NewTerminal(os.Stdin, os.Stderr)
+		} else {
+			backend = NonInteractive
+		}
+	}
+	return backend
+}
+
+// * * *
+
+// Ask asks a question, returning the answer or def if it is empty. If valid is
+// not nil, the question is repeated while the answer is not valid.
+//
+// The key identifies the question to get the answer without asking, from the
+// environment or from a file of answers (see LoadAnswers).
+func Ask(key, question, def string, valid func(string) error) (string, error) {
+	if def != "" {
+		question += " [" + def + "]"
+	}
+	return ask(key, question, def, valid)
+}
+
+// Confirm asks a question to answer yes or no, returning def if the answer is
+// empty.
+func Confirm(key, question string, def bool) (bool, error) {
+	hint, defAnswer := " [y/N]", "n"
+	if def {
+		hint, defAnswer = " [Y/n]", "y"
+	}
+
+	answer, err := ask(key, question+hint, defAnswer, func(answer string) error {
+		switch strings.ToLower(answer) {
+		case "y", "yes", "n", "no", "true", "false":
+			return nil
+		}
+		return errors.New("answer yes or no")
+	})
+	if err != nil {
+		return false, err
+	}
+
+	answer = strings.ToLower(answer)
+	return answer == "true" || strings.HasPrefix(answer, "y"), nil
+}
+
+// Select asks to choose an option from a list, returning its index. The option
+// at def is chosen if the answer is empty; if def is negative, there is not an
+// option by default. The answer can be the number of the option or its text.
+func Select(key, question string, options []string, def int) (int, error) {
+	if len(options) == 0 {
+		return -1, errors.New("no options to select")
+	}
+
+	// The options are not shown if there is an answer.
+	if _, ok := preseed(key); !ok {
+		list := make([]string, len(options))
+		for i, opt := range options {
+			list[i] = fmt.Sprintf("  %d) %s", i+1, opt)
+		}
+		if err := getBackend().Message(question + "\n" + strings.Join(list, "\n")); err != nil {
+			return -1, err
+		}
+	}
+
+	defAnswer := ""
+	if def >= 0 && def < len(options) {
+		defAnswer = strconv.Itoa(def + 1)
+	}
+
+	index := -1
+	_, err := Ask(key, "Select", defAnswer, func(answer string) error {
+		if index = optionIndex(options, answer); index == -1 {
+			return fmt.Errorf("select a number from 1 to %d", len(options))
+		}
+		return nil
+	})
+	if err != nil {
+		return -1, err
+	}
+	return index, nil
+}
+
+// optionIndex returns the index of the option with the number (from 1) or the
+// text in answer, or -1 if it is not found.
+func optionIndex(options []string, answer string) int {
+	if n, err := strconv.Atoi(answer); err == nil {
+		if n < 1 || n > len(options) {
+			return -1
+		}
+		return n - 1
+	}
+	for i, opt := range options {
+		if opt == answer {
+			return i
+		}
+	}
+	return -1
+}
+
+// Password asks for a password, which can not be empty.
+func Password(key, question string) ([]byte, error) {
+	if v, ok := preseed(key); ok {
+		if v == "" {
+			return nil, ErrEmpty
+		}
+		return []byte(v), nil
+	}
+	b := getBackend()
+
+	for i := 0; i < MAX_TRIES; i++ {
+		pass, err := b.AskPassword(question + ": ")
+		if err == ErrNonInteractive {
+			return nil, missing(key, question)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(pass) != 0 {
+			return pass, nil
+		}
+		b.Message(ErrEmpty.Error())
+	}
+	return nil, ErrEmpty
+}
+
+// PasswordConfirm asks for a password twice, with the question and then with
+// confirm, and it is asked again if both passwords do not match. It is not
+// confirmed if there is an answer for the key.
+func PasswordConfirm(key, question, confirm string) ([]byte, error) {
+	if _, ok := preseed(key); ok {
+		return Password(key, question)
+	}
+	b := getBackend()
+
+	for i := 0; i < MAX_TRIES; i++ {
+		pass, err := Password(key, question)
+		if err != nil {
+			return nil, err
+		}
+		pass2, err := Password(key, confirm)
+		if err != nil {
+			return nil, err
+		}
+
+		if string(pass) == string(pass2) {
+			return pass, nil
+		}
+		b.Message(ErrMismatch.Error())
+	}
+	return nil, ErrMismatch
+}
+
+// ask asks a question until the answer is valid, using def if the answer is
+// empty or if it is in non-interactive mode. The answer for the key, if any, is
+// used without asking.
+func ask(key, question, def string, valid func(string) error) (string, error) {
+	if v, ok := preseed(key); ok {
+		if v = strings.TrimSpace(v); v == "" {
+			if v = def; v == "" {
+				return "", fmt.Errorf("answer for %s: %s", key, ErrEmpty)
+			}
+		}
+		if valid != nil {
+			if err := valid(v); err != nil {
+				return "", fmt.Errorf("answer for %s: %s", key, err)
+			}
+		}
+		return v, nil
+	}
+	b := getBackend()
+
+	var err error
+	for i := 0; i < MAX_TRIES; i++ {
+		answer, e := b.Ask(question + ": ")
+		if e == ErrNonInteractive {
+			if def == "" {
+				return "", missing(key, question)
+			}
+			answer, e = "", nil
+		}
+		if e != nil {
+			return "", e
+		}
+
+		if answer = strings.TrimSpace(answer); answer == "" {
+			if answer = def; answer == "" {
+				err = ErrEmpty
+				b.Message(err.Error())
+				continue
+			}
+		}
+		if valid != nil {
+			if err = valid(answer); err != nil {
+				b.Message(err.Error())
+				continue
+			}
+		}
+		return answer, nil
+	}
+	return "", err
+}
@@ -0,0 +1,90 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package prompt
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTerminal(t *testing.T) {
+	out := new(bytes.Buffer)
+	SetBackend(NewTerminal(strings.NewReader(
+		"\n"+ // Ask: default
+			"x\nyes\n"+ // Ask: not valid, valid
+			"maybe\nn\n"+ // Confirm
+			"\n"+ // Confirm: default
+			"4\n2\n"+ // Select
+			strings.Repeat("k", 40)+"\nother\n"+ // PasswordConfirm: mismatch
+			"s3cr3t\ns3cr3t\n"), // PasswordConfirm
+		out))
+	defer SetBackend(nil)
+
+	if answer, err := Ask("", "Name", "root", nil); err != nil || answer != "root" {
+		t.Errorf("Ask with default: got %q (%v)", answer, err)
+	}
+	answer, err := Ask("", "Continue", "", func(s string) error {
+		if s != "yes" {
+			return errors.New("write yes")
+		}
+		return nil
+	})
+	if err != nil || answer != "yes" {
+		t.Errorf("Ask with validation: got %q (%v)", answer, err)
+	}
+
+	if ok, err := Confirm("", "Format", true); err != nil || ok {
+		t.Errorf("Confirm: got %v (%v)", ok, err)
+	}
+	if ok, err := Confirm("", "Mount", true); err != nil || !ok {
+		t.Errorf("Confirm with default: got %v (%v)", ok, err)
+	}
+
+	if i, err := Select("", "Disk", []string{"sda", "sdb", "sdc"}, -1); err != nil || i != 1 {
+		t.Errorf("Select: got %d (%v)", i, err)
+	}
+
+	if pass, err := PasswordConfirm("", "Password", "Again"); err != nil || string(pass) != "s3cr3t" {
+		t.Errorf("PasswordConfirm: got %q (%v)", pass, err)
+	}
+
+	for _, s := range []string{
+		"Name [root]: ",
+		"write yes\n",
+		"Format [Y/n]: answer yes or no\n",
+		"Disk\n  1) sda\n  2) sdb\n  3) sdc\n",
+		"select a number from 1 to 3\n",
+		ErrMismatch.Error(),
+	} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("output: %q not found in %q", s, out)
+		}
+	}
+}
+
+func TestNonInteractive(t *testing.T) {
+	SetBackend(NonInteractive)
+	defer SetBackend(nil)
+
+	if answer, err := Ask("", "Name", "root", nil); err != nil || answer != "root" {
+		t.Errorf("Ask with default: got %q (%v)", answer, err)
+	}
+	if _, err := Ask("host", "Host", "", nil); err == nil {
+		t.Error("Ask without default: expected error")
+	}
+	if ok, err := Confirm("", "Format", false); err != nil || ok {
+		t.Errorf("Confirm: got %v (%v)", ok, err)
+	}
+	if i, err := Select("", "Disk", []string{"sda", "sdb"}, 1); err != nil || i != 1 {
+		t.Errorf("Select: got %d (%v)", i, err)
+	}
+	if _, err := Password("", "Password"); err == nil {
+		t.Error("Password: expected error")
+	}
+}
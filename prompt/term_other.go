@@ -0,0 +1,20 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// +build !linux
+
+package prompt
+
+import "errors"
+
+// IsTerminal reports whether the file descriptor fd is a terminal. It is always
+// false in this system, so the answers are read without handling the terminal.
+func IsTerminal(fd int) bool { return false }
+
+// echoOff returns an error since the echo can not be turned off in this system.
+func echoOff(fd int) (restore func(), err error) {
+	return nil, errors.New("echo not supported in this system")
+}
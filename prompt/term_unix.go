@@ -0,0 +1,57 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+// +build linux
+
+package prompt
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// getTermios gets the settings of the terminal at fd.
+func getTermios(fd int, t *syscall.Termios) error {
+	_, _, e := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd),
+		syscall.TCGETS, uintptr(unsafe.Pointer(t)))
+	if e != 0 {
+		return e
+	}
+	return nil
+}
+
+// setTermios sets the settings of the terminal at fd.
+func setTermios(fd int, t *syscall.Termios) error {
+	_, _, e := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd),
+		syscall.TCSETS, uintptr(unsafe.Pointer(t)))
+	if e != 0 {
+		return e
+	}
+	return nil
+}
+
+// IsTerminal reports whether the file descriptor fd is a terminal.
+func IsTerminal(fd int) bool {
+	var t syscall.Termios
+	return getTermios(fd, &t) == nil
+}
+
+// echoOff turns off the echo in the terminal at fd, returning a function to
+// restore it.
+func echoOff(fd int) (restore func(), err error) {
+	var old syscall.Termios
+	if err = getTermios(fd, &old); err != nil {
+		return nil, err
+	}
+
+	t := old
+	t.Lflag &^= syscall.ECHO
+	t.Lflag |= syscall.ICANON | syscall.ISIG
+	if err = setTermios(fd, &t); err != nil {
+		return nil, err
+	}
+	return func() { setTermios(fd, &old) }, nil
+}
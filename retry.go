@@ -0,0 +1,65 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package shout
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Retry represents the policy to run again a command which fails, that is to
+// say, it returns an error. A command which returns ok=false without error, like
+// grep when nothing is matched, is only retried if Retryable asks for it. The
+// commands with Stdin or Stdout set are not retried.
+//
+// The delay between attempts grows exponentially, from Delay to MaxDelay, and
+// it is changed randomly by the fraction in Jitter so several scripts don't
+// retry at the same time.
+type Retry struct {
+	Attempts int           // maximum number of attempts; 0 or 1 to don't retry
+	Delay    time.Duration // delay after of the first attempt
+	MaxDelay time.Duration // maximum delay, if it is not zero
+	Jitter   float64       // fraction of the delay to add or subtract, from 0 to 1
+
+	// Retryable reports whether a command which failed with the exit status
+	// and standard error given should be run again; the exit status is -1 if
+	// the command could not be run. If it is nil, all errors are retried.
+	Retryable func(exitCode int, stderr []byte) bool
+}
+
+// retryable reports whether the failure should be retried, being failed
+// whether it returned an error.
+func (r Retry) retryable(failed bool, exitCode int, stderr []byte) bool {
+	if r.Retryable == nil {
+		return failed
+	}
+	return r.Retryable(exitCode, stderr)
+}
+
+// delay returns the time to wait after of the given attempt.
+func (r Retry) delay(attempt int) time.Duration {
+	d := r.Delay
+	for i := 1; i < attempt && (r.MaxDelay == 0 || d < r.MaxDelay); i++ {
+		d *= 2
+	}
+	if r.MaxDelay != 0 && d > r.MaxDelay {
+		d = r.MaxDelay
+	}
+
+	if r.Jitter > 0 {
+		d += time.Duration(r.Jitter * float64(d) * (2*rand.Float64() - 1))
+	}
+	return d
+}
+
+// RunRetry is like Run, but the command is run again when it fails, according
+// to the policy in r.
+func RunRetry(r Retry, command string) (output []byte, ok bool, err error) {
+	cmd := NewCommand(command)
+	cmd.Retry = r
+	return cmd.Run()
+}
@@ -0,0 +1,76 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package shout
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	r := Retry{Delay: time.Second, MaxDelay: 5 * time.Second}
+
+	for i, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if d := r.delay(i + 1); d != want {
+			t.Errorf("delay(%d) => got %s, want %s", i+1, d, want)
+		}
+	}
+
+	r.Jitter = 0.5
+	for i := 0; i < 20; i++ {
+		if d := r.delay(1); d < 500*time.Millisecond || d > 1500*time.Millisecond {
+			t.Errorf("delay with jitter => got %s", d)
+		}
+	}
+
+	// The command fails until a file is created.
+	name := filepath.Join(os.TempDir(), "test-retry")
+	os.Remove(name)
+	defer os.Remove(name)
+
+	out, ok, err := RunRetry(Retry{Attempts: 3, Delay: time.Millisecond},
+		"sh -c 'test -f "+name+" || { touch "+name+"; echo failed >&2; exit 1; }; echo done'")
+	if err != nil || !ok || string(out) != "done\n" {
+		t.Errorf("got (%q, %t, %v)", out, ok, err)
+	}
+
+	// ok=false without error is final.
+	os.Remove(name)
+	if _, ok, err = RunRetry(Retry{Attempts: 3, Delay: time.Millisecond},
+		"sh -c 'test -f "+name+" || { touch "+name+"; exit 1; }'"); ok || err != nil {
+		t.Errorf("not found => got (%t, %v), want no retry", ok, err)
+	}
+
+	// The input is consumed in the first attempt.
+	os.Remove(name)
+	cmd := NewCommand("sh -c 'cat; test -f " + name + " || { touch " + name + "; echo failed >&2; exit 1; }'")
+	cmd.Retry = Retry{Attempts: 3, Delay: time.Millisecond}
+	cmd.Stdin = strings.NewReader("input\n")
+	if _, _, err = cmd.Run(); err == nil {
+		t.Error("Stdin => got no error, want no retry")
+	}
+
+	attempts := 0
+	r = Retry{Attempts: 3, Delay: time.Millisecond,
+		Retryable: func(exitCode int, stderr []byte) bool {
+			attempts++
+			return exitCode == 1 && bytes.Contains(stderr, []byte("locked"))
+		},
+	}
+	if _, ok, _ = RunRetry(r, "sh -c 'echo locked >&2; exit 2'"); ok || attempts != 1 {
+		t.Errorf("not retryable => ok %t, attempts %d", ok, attempts)
+	}
+
+	attempts = 0
+	if _, _, err = RunRetry(r, "sh -c 'echo locked >&2; exit 1'"); err == nil || attempts != 2 {
+		t.Errorf("retryable => error %v, attempts %d", err, attempts)
+	}
+}
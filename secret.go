@@ -0,0 +1,133 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package shout
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// _SECRET_MASK is the text shown instead of a secret.
+const _SECRET_MASK = "******"
+
+// Secret represents a value, like a password or a token, which is masked in
+// the logs, traces, audit records and errors.
+//
+// It is masked when it is formatted but Runf passes its value to the command,
+// so it has to be used instead of Run to build a command line with secrets.
+type Secret string
+
+// String returns the secret masked.
+func (s Secret) String() string { return _SECRET_MASK }
+
+var (
+	secretMu sync.RWMutex
+	secrets  []string // sorted from the longest
+)
+
+// AddSecret registers values to be masked in the logs, traces, audit records
+// and errors.
+//
+// The variables whose name looks like a secret, i.e. MYSQL_PASSWORD or API_KEY,
+// are registered automatically when they are set in the session or given to a
+// command.
+func AddSecret(values ...string) {
+	secretMu.Lock()
+	defer secretMu.Unlock()
+
+L:
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		for _, s := range secrets {
+			if s == v {
+				continue L
+			}
+		}
+		secrets = append(secrets, v)
+	}
+
+	// The longest first, so a secret which contains another one is fully masked.
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+}
+
+// Redact returns s with the secrets masked.
+func Redact(s string) string {
+	secretMu.RLock()
+	defer secretMu.RUnlock()
+
+	for _, v := range secrets {
+		if strings.Contains(s, v) {
+			s = strings.Replace(s, v, _SECRET_MASK, -1)
+		}
+	}
+	return s
+}
+
+// isSecretName reports whether the name of a variable looks like of a secret.
+func isSecretName(name string) bool {
+	name = strings.ToUpper(name)
+
+	for _, v := range []string{"PASS", "PWD", "TOKEN", "SECRET", "CREDENTIAL"} {
+		if strings.Contains(name, v) && name != "PWD" && name != "OLDPWD" {
+			return true
+		}
+	}
+	return name == "KEY" || strings.HasSuffix(name, "_KEY")
+}
+
+// addSecretVars registers the values of the variables, in format "VAR=value",
+// whose name looks like a secret.
+func addSecretVars(vars []string) {
+	for _, v := range vars {
+		if i := strings.IndexByte(v, '='); i != -1 && isSecretName(v[:i]) {
+			AddSecret(v[i+1:])
+		}
+	}
+}
+
+// addSecretLine registers the values of the variables, in format "VAR=value",
+// whose name looks like a secret, found at the start of the words of a command
+// line which could not be parsed.
+func addSecretLine(line string) {
+	isBlank := func(c byte) bool { return c == ' ' || c == '\t' || c == '\n' }
+
+	for i := 0; i < len(line); i++ {
+		if i != 0 && !isBlank(line[i-1]) && line[i-1] != '|' {
+			continue
+		}
+		n := nameLen(line[i:])
+		if n == 0 || i+n == len(line) || line[i+n] != '=' || !isSecretName(line[i:i+n]) {
+			continue
+		}
+
+		var value []byte
+		j := i + n + 1
+		for ; j < len(line) && !isBlank(line[j]); j++ {
+			switch c := line[j]; c {
+			case '\'', '"':
+				end := strings.IndexByte(line[j+1:], c)
+				if end == -1 {
+					end = len(line) - j - 1
+				}
+				value = append(value, line[j+1:j+1+end]...)
+				j += end + 1
+			case '\\':
+				if j+1 < len(line) {
+					value = append(value, line[j+1])
+					j++
+				}
+			default:
+				value = append(value, c)
+			}
+		}
+		AddSecret(string(value))
+		i = j
+	}
+}
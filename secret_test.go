@@ -0,0 +1,64 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package shout
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSecret(t *testing.T) {
+	buf := new(bytes.Buffer)
+	oldLog, oldTrace := Log, TRACE
+	SetLogHandler(NewWriterHandler(buf))
+	TRACE = true
+	defer func() { Log, TRACE = oldLog, oldTrace }()
+
+	pass := Secret("s3cr3t-pass")
+	if s := fmt.Sprintf("%s %v", pass, pass); s != _SECRET_MASK+" "+_SECRET_MASK {
+		t.Errorf("Secret formatted => got %q", s)
+	}
+
+	// The command gets the value.
+	out, _, err := Runf("echo %s", pass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "s3cr3t-pass\n" {
+		t.Errorf("Runf => got %q, want %q", out, "s3cr3t-pass\n")
+	}
+
+	_, _, err = Runf("sh -c 'echo %s >&2; exit 1'", pass)
+	if err == nil || strings.Contains(err.Error(), "s3cr3t") {
+		t.Errorf("error not masked: %v", err)
+	}
+
+	// Variables with name of secret
+	Run("DB_PASSWORD=hunter22 API_KEY=k3y-value KEYMAP=es true")
+
+	// A command line which can not be parsed.
+	_, _, err = Run(`DB_PASSWORD=hunter23 TOKEN="t0k en" psql 'unterminated`)
+	if err == nil || strings.Contains(err.Error(), "hunter23") || strings.Contains(err.Error(), "t0k en") {
+		t.Errorf("error not masked: %v", err)
+	}
+
+	for _, v := range []string{"s3cr3t", "hunter22", "k3y-value", "hunter23", "t0k en"} {
+		if strings.Contains(buf.String(), v) {
+			t.Errorf("secret %q found in log:\n%s", v, buf)
+		}
+	}
+	if !strings.Contains(buf.String(), "KEYMAP=es") {
+		t.Errorf("value not secret masked in log:\n%s", buf)
+	}
+
+	AddSecret("abc", "abcdef")
+	if s := Redact("x abcdef abc"); s != "x "+_SECRET_MASK+" "+_SECRET_MASK {
+		t.Errorf("Redact => got %q", s)
+	}
+}
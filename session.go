@@ -0,0 +1,244 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package shout
+
+import (
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Chdir changes the current working directory to the named directory, like the
+// command cd. The variables PWD and OLDPWD are updated so the previous directory
+// can be got through "~-".
+func Chdir(dir string) error {
+	oldDir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	if err = os.Chdir(dir); err != nil {
+		return err
+	}
+
+	newDir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	updateEnv("OLDPWD="+oldDir, "PWD="+newDir)
+	return nil
+}
+
+// homeDir returns the home directory from the variable HOME or, if it is unset,
+// from the user database for the current user.
+func homeDir() string {
+	if home := Getenv("HOME"); home != "" {
+		return home
+	}
+	if u, err := user.LookupId(strconv.Itoa(os.Getuid())); err == nil {
+		return u.HomeDir
+	}
+	return ""
+}
+
+// lookPath searches for an executable named file in the directories of the
+// variable PATH in env, or in the session if env has not it; exec.LookPath uses
+// the PATH of the process instead.
+func lookPath(file string, env []string) (string, error) {
+	if strings.Contains(file, "/") {
+		if err := findExecutable(file); err != nil {
+			return "", &exec.Error{Name: file, Err: err}
+		}
+		return file, nil
+	}
+
+	pathList := getenv(env, "PATH")
+	if pathList == "" {
+		pathList = Getenv("PATH")
+	}
+
+	for _, dir := range filepath.SplitList(pathList) {
+		if dir == "" {
+			dir = "." // as in the shell
+		}
+		if name := filepath.Join(dir, file); findExecutable(name) == nil {
+			return name, nil
+		}
+	}
+	return "", &exec.Error{Name: file, Err: exec.ErrNotFound}
+}
+
+// findExecutable checks whether the file is executable.
+func findExecutable(file string) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	if m := info.Mode(); !m.IsDir() && m&0111 != 0 {
+		return nil
+	}
+	return os.ErrPermission
+}
+
+// * * *
+
+// == Environment
+
+// envMu protects _ENV, which is replaced on every change so a copy got with
+// environ can be used without locking.
+var envMu sync.RWMutex
+
+// environ returns the environment of the session. It must not be modified.
+func environ() []string {
+	Booting()
+
+	envMu.RLock()
+	defer envMu.RUnlock()
+	return _ENV
+}
+
+// updateEnv applies the changes to the environment of the session.
+func updateEnv(changes ...string) {
+	Booting()
+	addSecretVars(changes)
+
+	envMu.Lock()
+	_ENV = mergeEnv(_ENV, changes)
+	envMu.Unlock()
+}
+
+// Environ returns a copy of the environment of the session, which is passed to
+// the commands run by Run.
+func Environ() []string {
+	return append([]string{}, environ()...)
+}
+
+// Getenv retrieves the value of the variable named by the key in the
+// environment of the session.
+func Getenv(key string) string {
+	return getenv(environ(), key)
+}
+
+// Setenv sets the value of the variable named by the key in the environment of
+// the session, like the command export, so it is used in the next commands.
+func Setenv(key, value string) error {
+	if !isName(key) {
+		return errEnvVar
+	}
+	updateEnv(key + "=" + value)
+	return nil
+}
+
+// Unsetenv removes the variable named by the key from the environment of the
+// session.
+func Unsetenv(key string) {
+	updateEnv(key)
+}
+
+// ClearEnv removes all variables from the environment of the session, but the
+// ones named in keep.
+func ClearEnv(keep ...string) {
+	Booting()
+
+	envMu.Lock()
+	_ENV = filterEnv(_ENV, keep)
+	envMu.Unlock()
+}
+
+// mergeEnv returns a new environment with the changes applied to env. A change
+// in format "VAR=value" sets the variable, overriding any previous value, and
+// "VAR" removes it.
+func mergeEnv(env []string, changes []string) []string {
+	newEnv := make([]string, 0, len(env)+len(changes))
+	index := make(map[string]int, len(env)+len(changes)) // position in newEnv
+	removed := false
+
+	for _, list := range [][]string{env, changes} {
+		for _, v := range list {
+			key, hasValue := v, false
+			if i := strings.IndexByte(v, '='); i != -1 {
+				key, hasValue = v[:i], true
+			}
+
+			if i, ok := index[key]; ok {
+				if hasValue {
+					newEnv[i] = v
+				} else {
+					newEnv[i] = ""
+					delete(index, key)
+					removed = true
+				}
+				continue
+			}
+			if hasValue {
+				index[key] = len(newEnv)
+				newEnv = append(newEnv, v)
+			}
+		}
+	}
+
+	if removed {
+		env = newEnv
+		newEnv = newEnv[:0]
+		for _, v := range env {
+			if v != "" {
+				newEnv = append(newEnv, v)
+			}
+		}
+	}
+	return newEnv
+}
+
+// envChanges returns the changes from the environment in env to newEnv, in the
+// format used by mergeEnv.
+func envChanges(env, newEnv []string) []string {
+	var changes []string
+	old := make(map[string]string, len(env))
+
+	for _, v := range env {
+		if i := strings.IndexByte(v, '='); i != -1 {
+			old[v[:i]] = v
+		}
+	}
+
+	for _, v := range newEnv {
+		key := v
+		if i := strings.IndexByte(v, '='); i != -1 {
+			key = v[:i]
+		}
+		if old[key] != v {
+			changes = append(changes, v)
+		}
+		delete(old, key)
+	}
+	for key := range old {
+		changes = append(changes, key)
+	}
+
+	sort.Strings(changes[len(changes)-len(old):])
+	return changes
+}
+
+// filterEnv returns the variables of env named in keep.
+func filterEnv(env []string, keep []string) []string {
+	newEnv := make([]string, 0, len(keep))
+
+	for _, v := range env {
+		for _, key := range keep {
+			if strings.HasPrefix(v, key+"=") {
+				newEnv = append(newEnv, v)
+				break
+			}
+		}
+	}
+	return newEnv
+}
@@ -0,0 +1,65 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package shout
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEnv(t *testing.T) {
+	defer Unsetenv("SHOUT_Y")
+
+	if err := Setenv("SHOUT_Y", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Setenv("SHOUT Y", "1"); err != errEnvVar {
+		t.Errorf("Setenv with a bad name => got %v, want %q", err, errEnvVar)
+	}
+
+	tests := []struct {
+		cmd string
+		out string
+	}{
+		{`sh -c 'echo $SHOUT_Y'`, "1\n"},
+		{`SHOUT_Y=2 sh -c 'echo $SHOUT_Y'`, "2\n"},
+		{`HOME=/x sh -c 'echo $HOME'`, "/x\n"},
+	}
+
+	for _, v := range tests {
+		if out, _, err := Run(v.cmd); err != nil || string(out) != v.out {
+			t.Errorf("`%s` => got %q (%v), want %q", v.cmd, out, err, v.out)
+		}
+	}
+
+	c := NewCommand("env")
+	c.CleanEnv = true
+	c.KeepEnv = []string{"SHOUT_Y"}
+	c.Env = []string{"SHOUT_Z=3"}
+	c.CLocale = true
+
+	out, _, err := c.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "SHOUT_Y=1\nSHOUT_Z=3\nLC_ALL=C\n"; string(out) != want {
+		t.Errorf("clean environment => got %q, want %q", out, want)
+	}
+
+	c = NewCommand(`sh -c 'echo $SHOUT_Y'`)
+	c.Env = []string{"SHOUT_Y"}
+	if out, _, _ = c.Run(); string(out) != "\n" {
+		t.Errorf("unset in command => got %q, want %q", out, "\n")
+	}
+
+	Unsetenv("SHOUT_Y")
+	for _, v := range Environ() {
+		if strings.HasPrefix(v, "SHOUT_Y=") {
+			t.Errorf("Unsetenv => variable found in environment")
+		}
+	}
+}
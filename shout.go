@@ -7,22 +7,19 @@
 package shout
 
 import (
-	"io/ioutil"
 	"log"
-	"log/syslog"
+	"log/slog"
 	"os"
+	"strconv"
+	"strings"
 )
 
-const _LOG_FILE = "/.shout.log" // in boot
-
 var (
 	_ENV  []string
-	_HOME string // to expand symbol "~"
-	BOOT  bool   // does the script is being run during boot?
 	DEBUG bool
+	TRACE bool // log the commands run, like "set -x"; set by SHOUT_TRACE=1
 
-	logFile *os.File
-	Log     = log.New(ioutil.Discard, "", 0)
+	Log = slog.New(DiscardHandler) // log of shout; see StartLogger
 )
 
 // Sets environment variables and a null logger.
@@ -30,41 +27,18 @@ func init() {
 	log.SetFlags(0)
 	log.SetPrefix("ERROR: ")
 
-	if BOOT {
-		_ENV = []string{"PATH=" + PATH} // from file boot
-	} else {
-		_ENV = os.Environ()
-		_HOME = os.Getenv("HOME")
-	}
-
-	/*if path := os.Getenv("PATH"); path == "" {
-		if err = os.Setenv("PATH", PATH); err != nil {
-			log.Print(err)
-		}
-	}*/
+	_ENV = os.Environ() // the PATH is set in boot, see Booting
+	TRACE, _ = strconv.ParseBool(os.Getenv("SHOUT_TRACE"))
 }
 
-// StartLogger initializes the log file.
-func StartLogger() {
-	var err error
-
-	if BOOT {
-		if logFile, err = os.OpenFile(_LOG_FILE, os.O_WRONLY|os.O_TRUNC, 0); err != nil {
-			log.Print(err)
-		} else {
-			Log = log.New(logFile, "", log.Lshortfile)
+// getenv retrieves the value of the variable named by the key in env. As in
+// exec.Cmd, the last value is used when it is duplicated.
+func getenv(env []string, key string) string {
+	for i := len(env) - 1; i >= 0; i-- {
+		if strings.HasPrefix(env[i], key) && len(env[i]) > len(key) &&
+			env[i][len(key)] == '=' {
+			return env[i][len(key)+1:]
 		}
-	} else {
-		if Log, err = syslog.NewLogger(syslog.LOG_NOTICE, log.Lshortfile); err != nil {
-			log.Fatal(err)
-		}
-	}
-}
-
-// CloseLogger closes the log file.
-func CloseLogger() error {
-	if BOOT {
-		return logFile.Close()
 	}
-	return nil
+	return ""
 }
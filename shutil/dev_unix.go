@@ -118,15 +118,9 @@ func GetUSBremovables() (devices []string, err error) {
 	}
 
 	for _, p := range disksPath {
-		if DEBUG {
-			Writef("\nExamining " + p)
-		}
-
 		fullpath, err := os.Readlink(p)
 		if err != nil {
-			if DEBUG {
-				Writefln("%s", err)
-			}
+			Log.Debug("GetUSBremovables", "path", p, "error", err)
 			continue
 		}
 
@@ -135,9 +129,7 @@ func GetUSBremovables() (devices []string, err error) {
 			// Is the device removable?
 			file, err := os.Open(path.Join(p, "removable"))
 			if err != nil {
-				if DEBUG {
-					Writefln("%s", err)
-				}
+				Log.Debug("GetUSBremovables", "path", p, "error", err)
 				continue
 			}
 
@@ -146,18 +138,12 @@ func GetUSBremovables() (devices []string, err error) {
 
 			if bytes.Equal(firstLine, removableTag) {
 				devices = append(devices, path.Join("/dev", path.Base(p)))
-				if DEBUG {
-					Writef(": USB removable")
-				}
+				Log.Debug("GetUSBremovables", "path", p, "removable", true)
 			}
 
 			file.Close()
 		}
 	}
-	if DEBUG {
-		Writefln("")
-	}
-
 	if len(devices) == 0 {
 		return nil, ErrNoRemovUSB
 	}
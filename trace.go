@@ -0,0 +1,56 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package shout
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// The traces are written to Log when TRACE is set, with the message "+" like in
+// "set -x". The commands of a pipeline are numbered in the field "stage", i.e.
+// "1/2". If Log discards them, i.e. before of StartLogger or after of
+// CloseLogger, they are written to the standard error.
+
+// traceLog returns the logger for the traces: Log, or a logger to the standard
+// error if Log discards the records.
+func traceLog() *slog.Logger {
+	if !Log.Enabled(context.Background(), slog.LevelInfo) {
+		return slog.New(redactHandler{NewStderrHandler()})
+	}
+	return Log
+}
+
+// traceStart logs the command i of n before of starting it, with its path and
+// arguments after of the expansion, the changes in the environment of the
+// session (where a variable without value is unset), the working directory,
+// and the start time.
+func traceStart(i, n int, c *exec.Cmd, envChanges []string) {
+	dir := c.Dir
+	if dir == "" {
+		dir, _ = os.Getwd()
+	}
+
+	traceLog().Info("+", "stage", fmt.Sprintf("%d/%d", i+1, n), "path", c.Path,
+		"argv", c.Args, "dir", dir, "env", envChanges,
+		"start", time.Now().Format("15:04:05.000"))
+}
+
+// traceEnd logs the exit status of the command i of n, and its duration.
+func traceEnd(i, n, exitCode int, d time.Duration) {
+	traceLog().Info("+", "stage", fmt.Sprintf("%d/%d", i+1, n), "exit_code", exitCode,
+		"duration", d)
+}
+
+// traceError logs the error of a command line.
+func traceError(err error) {
+	traceLog().Error("+", "error", err)
+}
@@ -0,0 +1,62 @@
+// Copyright 2012 Jonas mg
+//
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at http://mozilla.org/MPL/2.0/.
+
+package shout
+
+import (
+	"bytes"
+	"os"
+	"regexp"
+	"testing"
+)
+
+func TestTrace(t *testing.T) {
+	buf := new(bytes.Buffer)
+	oldLog, oldTrace := Log, TRACE
+	SetLogHandler(NewWriterHandler(buf))
+	TRACE = true
+	defer func() { Log, TRACE = oldLog, oldTrace }()
+
+	if _, _, err := Run("SHOUT_T=1 echo cm*.go | cat"); err != nil {
+		t.Fatal(err)
+	}
+	Run("nocommand_shout")
+
+	for _, v := range []string{
+		`(?m)level=INFO msg=\+ stage=1/2 path=/\S+/echo argv="\[echo cmd.go cmd_test.go\]" dir=\S+ env="\[SHOUT_T=1\]" start=\S+$`,
+		`(?m)level=INFO msg=\+ stage=2/2 path=/\S+/cat argv=\[cat\] dir=\S+ env=\[\] start=\S+$`,
+		`(?m)level=INFO msg=\+ stage=1/2 exit_code=0 duration=\S+$`,
+		`(?m)level=INFO msg=\+ stage=2/2 exit_code=0 duration=\S+$`,
+		`(?m)level=ERROR msg=\+ error=.*nocommand_shout`,
+	} {
+		if !regexp.MustCompile(v).Match(buf.Bytes()) {
+			t.Errorf("trace not matched: %s\n%s", v, buf)
+		}
+	}
+}
+
+func TestTraceStderr(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// As after of CloseLogger.
+	oldLog, oldTrace, oldStderr := Log, TRACE, os.Stderr
+	SetLogHandler(DiscardHandler)
+	TRACE, os.Stderr = true, f
+	defer func() { Log, TRACE, os.Stderr = oldLog, oldTrace, oldStderr }()
+
+	if _, _, err = Run("true"); err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := os.ReadFile(f.Name())
+	if !regexp.MustCompile(`(?m)level=INFO msg=\+ stage=1/1 path=/\S+/true `).Match(b) {
+		t.Errorf("trace not written to stderr: %q", b)
+	}
+}